@@ -0,0 +1,99 @@
+package txoutbox
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ackBatch collects the outcomes of a cycle so a BulkAcknowledger can record them with one call per kind.
+type ackBatch struct {
+	mu      sync.Mutex
+	sent    []pendingAck
+	retried []pendingAck
+	failed  []pendingAck
+}
+
+// pendingAck is an acknowledgement waiting for the end of the cycle.
+type pendingAck struct {
+	// ctx carries the envelope's trace for the hooks fired once the ack is recorded.
+	ctx context.Context
+	env Envelope
+	ack Ack
+	// delay is the retry delay reported through OnRetry.
+	delay time.Duration
+}
+
+// newAckBatch returns a collector when the store supports bulk acknowledgements, or nil to acknowledge one by one.
+func (r *Relay) newAckBatch() *ackBatch {
+	if _, ok := r.store.(BulkAcknowledger); !ok {
+		return nil
+	}
+	return &ackBatch{}
+}
+
+func (b *ackBatch) add(list *[]pendingAck, p pendingAck) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*list = append(*list, p)
+}
+
+// flushAcks records the collected outcomes, skipping envelopes whose lease the heartbeat already found lost.
+func (r *Relay) flushAcks(ctx context.Context, acks *ackBatch, hb *heartbeat) {
+	if acks == nil {
+		return
+	}
+	bulk := r.store.(BulkAcknowledger)
+	r.flushKind(ctx, "send", acks.sent, hb, bulk.SendMany, func(p pendingAck) {
+		r.sent(p.ctx, p.env)
+	})
+	r.flushKind(ctx, "retry", acks.retried, hb, bulk.RetryMany, func(p pendingAck) {
+		r.retried(p.ctx, p.env, p.ack.Attempt, p.delay)
+	})
+	r.flushKind(ctx, "fail", acks.failed, hb, bulk.FailMany, func(p pendingAck) {
+		r.failed(p.ctx, p.env, p.ack.Attempt)
+	})
+}
+
+// flushKind writes one kind of acknowledgement with a single bulk call and reports each outcome like the
+// per-envelope path would.
+func (r *Relay) flushKind(
+	ctx context.Context,
+	op string,
+	pending []pendingAck,
+	hb *heartbeat,
+	apply func(context.Context, []Ack) ([]Lease, error),
+	done func(pendingAck),
+) {
+	kept := pending[:0]
+	for _, p := range pending {
+		if !hb.lost(p.env.ID) {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		return
+	}
+	acks := make([]Ack, len(kept))
+	for i, p := range kept {
+		acks[i] = p.ack
+	}
+	lost, err := apply(ctx, acks)
+	if err != nil {
+		for _, p := range kept {
+			r.handleStoreError(p.ctx, p.env, op, err, p.ack.Attempt.Err)
+		}
+		return
+	}
+	lostIDs := make(map[int64]bool, len(lost))
+	for _, lease := range lost {
+		lostIDs[lease.ID] = true
+	}
+	for _, p := range kept {
+		if lostIDs[p.env.ID] {
+			r.handleStoreError(p.ctx, p.env, op, ErrLeaseLost, p.ack.Attempt.Err)
+			continue
+		}
+		done(p)
+	}
+}
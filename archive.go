@@ -0,0 +1,43 @@
+package txoutbox
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoArchive is returned by archive operations on a store that is not running in archive mode.
+var ErrNoArchive = errors.New("txoutbox: archive table is not configured")
+
+// ArchivedMessage is a delivered message moved to the archive table by a store running in archive mode.
+type ArchivedMessage struct {
+	Envelope
+	// SentAt is when the message was delivered.
+	SentAt time.Time
+}
+
+// ArchiveFilter selects archived messages. Zero-valued fields are ignored.
+type ArchiveFilter struct {
+	// Topic matches the message topic exactly.
+	Topic string
+	// Key matches the message key exactly.
+	Key string
+	// SentAfter keeps messages delivered at or after the given time.
+	SentAfter time.Time
+	// SentBefore keeps messages delivered strictly before the given time.
+	SentBefore time.Time
+}
+
+// Archive is implemented by stores that can look up delivered messages kept in an archive table for audit.
+type Archive interface {
+	// ListArchived returns archived messages matching filter, ordered by ID. A store without an archive table returns
+	// ErrNoArchive.
+	ListArchived(ctx context.Context, filter ArchiveFilter, page Page) ([]ArchivedMessage, error)
+}
+
+// ArchivePurger is implemented by archive stores that can remove old archived messages.
+type ArchivePurger interface {
+	// PurgeArchived deletes up to limit archived messages delivered before the cutoff, returning how many rows were removed.
+	// A store without an archive table returns ErrNoArchive.
+	PurgeArchived(ctx context.Context, before time.Time, limit int) (int64, error)
+}
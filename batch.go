@@ -0,0 +1,131 @@
+package txoutbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// BatchSender is implemented by senders whose transport accepts many messages per call (Kafka, SQS
+// SendMessageBatch, Pub/Sub). When the relay's Sender implements it, each claimed batch is handed over in a single
+// SendBatch call instead of one Send per envelope.
+//
+// The SendBatch context is bounded by the largest timeout that applies to the batch's topics (SendTimeout or its
+// TopicSendTimeouts override); when any of them has the timeout disabled, the call has no deadline. The context is
+// also cancelled, with ErrLeaseLost as cause, once the heartbeat has lost the lease of every envelope in the batch.
+type BatchSender interface {
+	Sender
+	// SendBatch delivers envelopes, in claim order, and returns one error per envelope at the same index; nil marks
+	// a success. Errors may be wrapped with Permanent, RetryAfter or Release like those returned by Send.
+	// The context carries no per-envelope trace, since the batch spans many messages.
+	SendBatch(ctx context.Context, envelopes []Envelope) []error
+}
+
+// deliverBatch sends envelopes through bs in one call and acknowledges each outcome like deliver, returning how
+// many envelopes the sender declined with Release.
+func (r *Relay) deliverBatch(ctx context.Context, bs BatchSender, envelopes []Envelope, hb *heartbeat, acks *ackBatch) int {
+	batch := make([]Envelope, 0, len(envelopes))
+	leases := make([]context.Context, 0, len(envelopes))
+	for _, env := range envelopes {
+		if leaseCtx, ok := hb.begin(ctx, env); ok {
+			batch = append(batch, env)
+			leases = append(leases, leaseCtx)
+		}
+	}
+	if len(batch) == 0 {
+		return 0
+	}
+
+	sendCtx, stop := context.WithCancelCause(ctx)
+	go cancelWhenAllLost(sendCtx, stop, leases)
+	timeout := r.batchSendTimeout(batch)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeoutCause(sendCtx, timeout, ErrSendTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	errs := r.sendBatch(sendCtx, bs, batch)
+	took := time.Since(start)
+	stop(nil)
+	if acks == nil {
+		for _, env := range batch {
+			hb.finish(env)
+		}
+	}
+	timedOut := errors.Is(context.Cause(sendCtx), ErrSendTimeout)
+
+	released := 0
+	for i, env := range batch {
+		if errors.Is(context.Cause(leases[i]), ErrLeaseLost) {
+			continue
+		}
+		err := errs[i]
+		if err != nil && timedOut {
+			err = fmt.Errorf("%w after %s: %w", ErrSendTimeout, timeout, err)
+		}
+		ackCtx := ctx
+		if !env.Trace.IsZero() {
+			ackCtx = r.opts.Propagator.Extract(ackCtx, env.Trace)
+		}
+		if !r.acknowledge(ackCtx, env, err, took, acks) {
+			released++
+		}
+	}
+	return released
+}
+
+// batchSendTimeout returns the SendBatch deadline for envelopes: the largest timeout applying to their topics, or
+// zero when any of them has the timeout disabled.
+func (r *Relay) batchSendTimeout(envelopes []Envelope) time.Duration {
+	var longest time.Duration
+	for _, env := range envelopes {
+		d := r.sendTimeout(env.Topic)
+		if d <= 0 {
+			return 0
+		}
+		longest = max(longest, d)
+	}
+	return longest
+}
+
+// cancelWhenAllLost cancels ctx with ErrLeaseLost once every lease context has been cancelled for that cause.
+// It returns early when ctx ends or a lease context ends for another reason.
+func cancelWhenAllLost(ctx context.Context, cancel context.CancelCauseFunc, leases []context.Context) {
+	for _, lease := range leases {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lease.Done():
+		}
+		if !errors.Is(context.Cause(lease), ErrLeaseLost) {
+			return
+		}
+	}
+	cancel(ErrLeaseLost)
+}
+
+// sendBatch calls the BatchSender, turning a panic or a result slice of the wrong length into an error for every
+// envelope so each one is retried or failed.
+func (r *Relay) sendBatch(ctx context.Context, bs BatchSender, envelopes []Envelope) (errs []error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			errs = repeatError(fmt.Errorf("%w: %v\n%s", ErrSenderPanic, rec, debug.Stack()), len(envelopes))
+		}
+	}()
+	errs = bs.SendBatch(ctx, envelopes)
+	if len(errs) != len(envelopes) {
+		return repeatError(fmt.Errorf("txoutbox: SendBatch returned %d results for %d envelopes", len(errs), len(envelopes)), len(envelopes))
+	}
+	return errs
+}
+
+func repeatError(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,74 @@
+package txoutbox
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by DeadLetters.GetFailed when no failed message has the given ID.
+var ErrNotFound = errors.New("txoutbox: message not found")
+
+// ErrEmptyFilter is returned by DeadLetters.RequeueFailed and DiscardFailed when the filter sets no field and
+// All is false, so a forgotten filter cannot replay or delete every failed message.
+var ErrEmptyFilter = errors.New("txoutbox: dead-letter filter is empty; set a field or All")
+
+// DeadLetter is a permanently failed message as seen by operators.
+type DeadLetter struct {
+	Envelope
+	// LastError is the error recorded by the final delivery attempt; empty when none was persisted.
+	LastError string
+	// FailedAt is when the final attempt completed; zero for rows failed before attempts were tracked.
+	FailedAt time.Time
+}
+
+// DeadLetterFilter selects failed messages. Zero-valued fields are ignored, so the zero filter matches every
+// failed message in ListFailed; RequeueFailed and DiscardFailed reject it unless All is set.
+type DeadLetterFilter struct {
+	// All confirms that a filter without any other field is meant to select every failed message.
+	All bool
+	// IDs restricts the selection to the given primary keys, e.g. rows picked from a ListFailed page.
+	IDs []int64
+	// Topic matches the message topic exactly.
+	Topic string
+	// Key matches the message key exactly.
+	Key string
+	// FailedAfter keeps messages that failed at or after the given time.
+	FailedAfter time.Time
+	// FailedBefore keeps messages that failed strictly before the given time.
+	FailedBefore time.Time
+	// ErrorContains keeps messages whose last error contains the substring.
+	ErrorContains string
+}
+
+// IsEmpty reports whether f sets no field other than All.
+func (f DeadLetterFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && f.Topic == "" && f.Key == "" && f.FailedAfter.IsZero() && f.FailedBefore.IsZero() &&
+		f.ErrorContains == ""
+}
+
+// Page selects a window of results ordered by ID. Pass the ID of the last row received as AfterID to fetch
+// the next page.
+type Page struct {
+	// AfterID skips rows with an ID less than or equal to it.
+	AfterID int64
+	// Limit caps the number of rows returned; non-positive values use DefaultPageLimit.
+	Limit int
+}
+
+// DefaultPageLimit is the page size used when Page.Limit is not set.
+const DefaultPageLimit = 100
+
+// DeadLetters is implemented by stores that let operators inspect and replay permanently failed messages.
+type DeadLetters interface {
+	// ListFailed returns failed messages matching filter, ordered by ID.
+	ListFailed(ctx context.Context, filter DeadLetterFilter, page Page) ([]DeadLetter, error)
+	// GetFailed returns a single failed message, or ErrNotFound.
+	GetFailed(ctx context.Context, id int64) (DeadLetter, error)
+	// RequeueFailed makes matching failed messages claimable again with retry_count reset to zero,
+	// returning how many rows were requeued. An empty filter without All returns ErrEmptyFilter.
+	RequeueFailed(ctx context.Context, filter DeadLetterFilter) (int64, error)
+	// DiscardFailed deletes matching failed messages and their attempt history in one transaction, returning how
+	// many messages were removed. An empty filter without All returns ErrEmptyFilter.
+	DiscardFailed(ctx context.Context, filter DeadLetterFilter) (int64, error)
+}
@@ -7,11 +7,49 @@ CREATE TABLE IF NOT EXISTS txoutbox (
     topic VARCHAR(255) NOT NULL,
     `key` VARCHAR(255) NULL,
     payload JSON NOT NULL,
+    headers JSON NULL,
+    traceparent VARCHAR(55) NULL,
+    tracestate VARCHAR(512) NULL,
     status VARCHAR(32) NOT NULL DEFAULT 'pending',
     retry_count INT NOT NULL DEFAULT 0,
     next_retry_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     claimed_by VARCHAR(255),
     claimed_at TIMESTAMP NULL,
+    lease_token BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    last_attempt_at TIMESTAMP NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    sent_at TIMESTAMP NULL
+    sent_at TIMESTAMP NULL,
+    dedup_key VARCHAR(255) NULL,
+    supersedes INT NOT NULL DEFAULT 0,
+    INDEX idx_txoutbox_key_id (`key`, id),
+    UNIQUE INDEX idx_txoutbox_dedup_key (dedup_key)
+);
+
+CREATE TABLE IF NOT EXISTS txoutbox_attempts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    message_id BIGINT NOT NULL,
+    attempt INT NOT NULL,
+    worker_id VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    error TEXT NULL,
+    duration_ms BIGINT NOT NULL,
+    attempted_at TIMESTAMP NOT NULL,
+    INDEX idx_txoutbox_attempts_message_id (message_id)
+);
+
+CREATE TABLE IF NOT EXISTS txoutbox_archive (
+    id BIGINT PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    `key` VARCHAR(255) NULL,
+    payload JSON NOT NULL,
+    headers JSON NULL,
+    traceparent VARCHAR(55) NULL,
+    tracestate VARCHAR(512) NULL,
+    retry_count INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    claimed_by VARCHAR(255) NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_txoutbox_archive_topic_sent_at (topic, sent_at),
+    INDEX idx_txoutbox_archive_key (`key`)
 );
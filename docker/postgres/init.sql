@@ -8,15 +8,58 @@ CREATE TABLE txoutbox
     topic         TEXT        NOT NULL,
     key           TEXT,
     payload       JSONB       NOT NULL,
+    headers       JSONB,
+    traceparent   TEXT,
+    tracestate    TEXT,
     status        TEXT        NOT NULL DEFAULT 'pending',
     retry_count   INT         NOT NULL DEFAULT 0,
     next_retry_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     claimed_by    TEXT,
     claimed_at    TIMESTAMPTZ,
+    lease_token   BIGINT      NOT NULL DEFAULT 0,
+    last_error    TEXT,
+    last_attempt_at TIMESTAMPTZ,
     created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    sent_at       TIMESTAMPTZ
+    sent_at       TIMESTAMPTZ,
+    dedup_key     TEXT,
+    supersedes    INT         NOT NULL DEFAULT 0
 );
 
+CREATE INDEX txoutbox_key_id_idx ON txoutbox (key, id);
+CREATE UNIQUE INDEX txoutbox_dedup_key_idx ON txoutbox (dedup_key);
+
+CREATE TABLE txoutbox_attempts
+(
+    id           BIGSERIAL PRIMARY KEY,
+    message_id   BIGINT      NOT NULL,
+    attempt      INT         NOT NULL,
+    worker_id    TEXT        NOT NULL,
+    status       TEXT        NOT NULL,
+    error        TEXT,
+    duration_ms  BIGINT      NOT NULL,
+    attempted_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX txoutbox_attempts_message_id_idx ON txoutbox_attempts (message_id);
+
+CREATE TABLE txoutbox_archive
+(
+    id          BIGINT PRIMARY KEY,
+    topic       TEXT        NOT NULL,
+    key         TEXT,
+    payload     JSONB       NOT NULL,
+    headers     JSONB,
+    traceparent TEXT,
+    tracestate  TEXT,
+    retry_count INT         NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    claimed_by  TEXT,
+    sent_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX txoutbox_archive_topic_sent_at_idx ON txoutbox_archive (topic, sent_at);
+CREATE INDEX txoutbox_archive_key_idx ON txoutbox_archive (key);
+
 CREATE TABLE IF NOT EXISTS orders
 (
     id         TEXT PRIMARY KEY,
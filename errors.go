@@ -0,0 +1,85 @@
+package txoutbox
+
+import (
+	"errors"
+	"time"
+)
+
+// Permanent marks err as non-retryable: the relay fails the message immediately instead of spending the
+// remaining attempts. Permanent(nil) returns nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// RetryAfter marks err as retryable after d, overriding the Backoff delay (e.g. to honor an HTTP Retry-After).
+// The attempt still counts towards MaxAttempts. RetryAfter(nil, d) returns nil.
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: d}
+}
+
+// Release tells the relay the sender did not attempt delivery (e.g. a paused topic or a local rate limit):
+// the row is handed back through Store.Release without counting an attempt and is claimable again at once.
+// Release(nil) returns nil.
+func Release(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &releaseError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked with Permanent.
+func IsPermanent(err error) bool {
+	var target *permanentError
+	return errors.As(err, &target)
+}
+
+// IsReleased reports whether err, or any error it wraps, was marked with Release.
+func IsReleased(err error) bool {
+	var target *releaseError
+	return errors.As(err, &target)
+}
+
+// RetryDelay returns the delay requested through RetryAfter, if any.
+func RetryDelay(err error) (time.Duration, bool) {
+	var target *retryAfterError
+	if !errors.As(err, &target) {
+		return 0, false
+	}
+	return target.delay, true
+}
+
+// permanentError flags an error that can never succeed on retry.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return "permanent: " + e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// retryAfterError carries a sender-provided retry delay.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return "retry after " + e.delay.String() + ": " + e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// releaseError flags a send the sender declined to attempt.
+type releaseError struct {
+	err error
+}
+
+func (e *releaseError) Error() string { return "released: " + e.err.Error() }
+
+func (e *releaseError) Unwrap() error { return e.err }
@@ -0,0 +1,68 @@
+package txoutbox_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mickamy/txoutbox"
+)
+
+func TestPermanent(t *testing.T) {
+	t.Parallel()
+	base := errors.New("bad request")
+	err := fmt.Errorf("send: %w", txoutbox.Permanent(base))
+
+	if !txoutbox.IsPermanent(err) {
+		t.Fatal("IsPermanent() = false, want true")
+	}
+	if !errors.Is(err, base) {
+		t.Fatal("Permanent error does not unwrap to the original error")
+	}
+	if txoutbox.IsPermanent(base) {
+		t.Fatal("IsPermanent(base) = true, want false")
+	}
+	if txoutbox.Permanent(nil) != nil {
+		t.Fatal("Permanent(nil) != nil")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+	base := errors.New("too many requests")
+	err := fmt.Errorf("send: %w", txoutbox.RetryAfter(base, 3*time.Second))
+
+	d, ok := txoutbox.RetryDelay(err)
+	if !ok || d != 3*time.Second {
+		t.Fatalf("RetryDelay() = %s, %v; want 3s, true", d, ok)
+	}
+	if !errors.Is(err, base) {
+		t.Fatal("RetryAfter error does not unwrap to the original error")
+	}
+	if _, ok := txoutbox.RetryDelay(base); ok {
+		t.Fatal("RetryDelay(base) reported a delay")
+	}
+	if txoutbox.RetryAfter(nil, time.Second) != nil {
+		t.Fatal("RetryAfter(nil) != nil")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	t.Parallel()
+	base := errors.New("topic paused")
+	err := fmt.Errorf("send: %w", txoutbox.Release(base))
+
+	if !txoutbox.IsReleased(err) {
+		t.Fatal("IsReleased() = false, want true")
+	}
+	if !errors.Is(err, base) {
+		t.Fatal("Release error does not unwrap to the original error")
+	}
+	if txoutbox.IsReleased(base) {
+		t.Fatal("IsReleased(base) = true, want false")
+	}
+	if txoutbox.Release(nil) != nil {
+		t.Fatal("Release(nil) != nil")
+	}
+}
@@ -44,11 +44,12 @@ func main() {
 		log.Fatalf("insert order: %v", err)
 	}
 
-	store := stores.NewPostgres(db)
-	if err := enqueue(ctx, store, db, o); err != nil {
+	store := stores.NewPostgres(db, stores.WithPostgresNotify("txoutbox"))
+	id, err := enqueue(ctx, store, db, o)
+	if err != nil {
 		log.Fatalf("enqueue outbox: %v", err)
 	}
-	log.Printf("enqueued order %s", o.ID)
+	log.Printf("enqueued order %s as outbox message %d", o.ID, id)
 }
 
 func newID() string {
@@ -66,24 +67,26 @@ func insertOrder(ctx context.Context, db *sql.DB, o order) error {
 	return err
 }
 
-func enqueue(ctx context.Context, store txoutbox.Store, db *sql.DB, o order) error {
+func enqueue(ctx context.Context, store txoutbox.Store, db *sql.DB, o order) (int64, error) {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() { _ = tx.Rollback() }()
 
 	payload, err := json.Marshal(o)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := store.Add(ctx, tx, txoutbox.Message{
-		Topic: "order.created",
-		Key:   o.ID,
-		Body:  json.RawMessage(payload),
-	}); err != nil {
-		return err
+	id, err := store.Add(ctx, tx, txoutbox.Message{
+		Topic:   "order.created",
+		Key:     o.ID,
+		Body:    json.RawMessage(payload),
+		Headers: map[string]string{"X-Order-Currency": o.Currency},
+	})
+	if err != nil {
+		return 0, err
 	}
-	return tx.Commit()
+	return id, tx.Commit()
 }
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/mickamy/txoutbox"
@@ -41,10 +44,34 @@ func main() {
 		BatchSize:   50,
 		LeaseTTL:    30 * time.Second,
 		MaxAttempts: 5,
+		SendTimeout: 10 * time.Second,
 		Logger:      logAdapter{},
 		Hooks:       hooks,
+		Notifier:    stores.NewPostgresNotifier(db, "txoutbox", stores.WithPostgresNotifierLogger(logAdapter{})),
 	})
 
+	janitor := txoutbox.NewJanitor(store, txoutbox.JanitorOptions{
+		SentRetention:   7 * 24 * time.Hour,
+		FailedRetention: 30 * 24 * time.Hour,
+		Logger:          logAdapter{},
+		Hooks:           hooks,
+	})
+	go func() {
+		if err := janitor.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("janitor stopped: %v", err)
+		}
+	}()
+
+	go func() {
+		sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-sigCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+		defer cancel()
+		released, err := relay.Shutdown(shutdownCtx)
+		log.Printf("relay shut down (released=%d, err=%v)", released, err)
+	}()
+
 	log.Printf("relay started (sender=%s)", cfg.Sender)
 	if err := relay.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		log.Fatalf("relay stopped: %v", err)
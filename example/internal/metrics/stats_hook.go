@@ -19,8 +19,15 @@ type StatsHook struct {
 	retries        atomic.Int64
 	failures       atomic.Int64
 	storeErrors    atomic.Int64
+	leaseLost      atomic.Int64
+	released       atomic.Int64
+	purgedSent     atomic.Int64
+	purgedFailed   atomic.Int64
+	purgedArchive  atomic.Int64
+	superseded     atomic.Int64
 	cycles         atomic.Int64
 	cycleLatencyNs atomic.Int64
+	pollIntervalNs atomic.Int64
 }
 
 // NewStatsHook registers an expvar entry named "<prefix>_stats".
@@ -66,12 +73,44 @@ func (h *StatsHook) OnStoreError(_ context.Context, _ string, _ int64, _ error)
 	h.storeErrors.Add(1)
 }
 
+// OnLeaseLost increments acknowledgements rejected because the lease expired.
+func (h *StatsHook) OnLeaseLost(_ context.Context, _ txoutbox.Envelope, _ string) {
+	h.leaseLost.Add(1)
+}
+
 // OnCycle records cycle durations and counts.
 func (h *StatsHook) OnCycle(_ context.Context, d time.Duration) {
 	h.cycles.Add(1)
 	h.cycleLatencyNs.Add(d.Nanoseconds())
 }
 
+// OnRelease increments messages handed back without an attempt.
+func (h *StatsHook) OnRelease(_ context.Context, _ txoutbox.Envelope, _ string) {
+	h.released.Add(1)
+}
+
+// OnPollInterval records the latest wait chosen by the relay as a gauge.
+func (h *StatsHook) OnPollInterval(_ context.Context, interval time.Duration) {
+	h.pollIntervalNs.Store(interval.Nanoseconds())
+}
+
+// OnPurge accumulates rows removed by the janitor per status.
+func (h *StatsHook) OnPurge(_ context.Context, status string, removed int64) {
+	switch status {
+	case "sent":
+		h.purgedSent.Add(removed)
+	case "failed":
+		h.purgedFailed.Add(removed)
+	case "archived":
+		h.purgedArchive.Add(removed)
+	}
+}
+
+// OnSuperseded accumulates older messages replaced by delivered ones on coalesced topics.
+func (h *StatsHook) OnSuperseded(_ context.Context, _ txoutbox.Envelope, count int) {
+	h.superseded.Add(int64(count))
+}
+
 func (h *StatsHook) snapshot() map[string]int64 {
 	return map[string]int64{
 		"requested":        h.requested.Load(),
@@ -81,7 +120,14 @@ func (h *StatsHook) snapshot() map[string]int64 {
 		"retries":          h.retries.Load(),
 		"failures":         h.failures.Load(),
 		"store_errors":     h.storeErrors.Load(),
+		"lease_lost":       h.leaseLost.Load(),
+		"released":         h.released.Load(),
+		"purged_sent":      h.purgedSent.Load(),
+		"purged_failed":    h.purgedFailed.Load(),
+		"purged_archived":  h.purgedArchive.Load(),
+		"superseded":       h.superseded.Load(),
 		"cycles":           h.cycles.Load(),
 		"cycle_latency_ns": h.cycleLatencyNs.Load(),
+		"poll_interval_ns": h.pollIntervalNs.Load(),
 	}
 }
@@ -19,7 +19,13 @@ func TestStatsHookTracksCounters(t *testing.T) {
 	hook.OnRetry(context.Background(), env, 2, time.Second)
 	hook.OnFail(context.Background(), env, 3, fmt.Errorf("fail"))
 	hook.OnStoreError(context.Background(), "send", env.ID, fmt.Errorf("db down"))
+	hook.OnLeaseLost(context.Background(), env, "send")
 	hook.OnCycle(context.Background(), time.Millisecond)
+	hook.OnRelease(context.Background(), env, "shutdown")
+	hook.OnPollInterval(context.Background(), 2*time.Second)
+	hook.OnPurge(context.Background(), "sent", 5)
+	hook.OnPurge(context.Background(), "failed", 2)
+	hook.OnPurge(context.Background(), "archived", 9)
 
 	snap := hook.snapshot()
 	if snap["requested"] != 3 {
@@ -37,6 +43,18 @@ func TestStatsHookTracksCounters(t *testing.T) {
 	if snap["store_errors"] != 1 {
 		t.Fatalf("store_errors = %d, want 1", snap["store_errors"])
 	}
+	if snap["lease_lost"] != 1 {
+		t.Fatalf("lease_lost = %d, want 1", snap["lease_lost"])
+	}
+	if snap["released"] != 1 {
+		t.Fatalf("released = %d, want 1", snap["released"])
+	}
+	if snap["poll_interval_ns"] != (2 * time.Second).Nanoseconds() {
+		t.Fatalf("poll_interval_ns = %d, want %d", snap["poll_interval_ns"], (2 * time.Second).Nanoseconds())
+	}
+	if snap["purged_sent"] != 5 || snap["purged_failed"] != 2 || snap["purged_archived"] != 9 {
+		t.Fatalf("purge counters = %+v", snap)
+	}
 	if snap["cycles"] != 1 {
 		t.Fatalf("cycles = %d, want 1", snap["cycles"])
 	}
@@ -3,9 +3,14 @@ package senders
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 
 	"github.com/mickamy/txoutbox"
 	internalSQS "github.com/mickamy/txoutbox/example/internal/lib/aws/sqs"
@@ -29,8 +34,110 @@ func NewSQS(ctx context.Context, endpointURL, queueURL string) (*SQSSender, erro
 	}, nil
 }
 
+const (
+	// maxBatchEntries is the most entries SendMessageBatch accepts per call.
+	maxBatchEntries = 10
+	// maxBatchBytes bounds the summed size of the entries in one SendMessageBatch call, and of any single message.
+	maxBatchBytes = 256 * 1024
+)
+
 // Send implements txoutbox.Sender by posting the raw JSON payload to SQS.
 func (s *SQSSender) Send(ctx context.Context, msg txoutbox.Envelope) error {
+	body, err := messageBody(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(s.queueURL),
+		MessageBody:       aws.String(body),
+		MessageAttributes: messageAttributes(msg.Headers),
+	})
+	return err
+}
+
+// SendBatch implements txoutbox.BatchSender with SendMessageBatch, splitting the envelopes into requests of at most
+// ten entries and 256 KiB in total. Entries SQS rejects as the sender's fault (e.g. an oversized body) are failed
+// permanently; others are retried.
+func (s *SQSSender) SendBatch(ctx context.Context, msgs []txoutbox.Envelope) []error {
+	errs := make([]error, len(msgs))
+	var (
+		entries []types.SendMessageBatchRequestEntry
+		size    int
+	)
+	flush := func() {
+		if len(entries) > 0 {
+			s.sendEntries(ctx, entries, errs)
+		}
+		entries, size = nil, 0
+	}
+	for i, msg := range msgs {
+		body, err := messageBody(msg)
+		if err != nil {
+			errs[i] = txoutbox.Permanent(err)
+			continue
+		}
+		attrs := messageAttributes(msg.Headers)
+		n := messageSize(body, attrs)
+		if n > maxBatchBytes {
+			errs[i] = txoutbox.Permanent(fmt.Errorf("sqs: message of %d bytes exceeds the %d-byte limit", n, maxBatchBytes))
+			continue
+		}
+		if len(entries) == maxBatchEntries || size+n > maxBatchBytes {
+			flush()
+		}
+		entries = append(entries, types.SendMessageBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			MessageBody:       aws.String(body),
+			MessageAttributes: attrs,
+		})
+		size += n
+	}
+	flush()
+	return errs
+}
+
+// sendEntries issues one SendMessageBatch call and stores each entry's outcome in errs at the index encoded in its Id.
+func (s *SQSSender) sendEntries(ctx context.Context, entries []types.SendMessageBatchRequestEntry, errs []error) {
+	ids := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		i, _ := strconv.Atoi(aws.ToString(entry.Id))
+		ids[aws.ToString(entry.Id)] = i
+	}
+	out, err := s.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(s.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		for _, i := range ids {
+			errs[i] = err
+		}
+		return
+	}
+	for _, failed := range out.Failed {
+		i, ok := ids[aws.ToString(failed.Id)]
+		if !ok {
+			continue
+		}
+		errs[i] = fmt.Errorf("sqs: %s: %s", aws.ToString(failed.Code), aws.ToString(failed.Message))
+		if failed.SenderFault {
+			errs[i] = txoutbox.Permanent(errs[i])
+		}
+	}
+}
+
+// messageSize returns how many bytes SQS counts against its size limit: the body plus every attribute's name, data
+// type and value.
+func messageSize(body string, attrs map[string]types.MessageAttributeValue) int {
+	n := len(body)
+	for name, attr := range attrs {
+		n += len(name) + len(aws.ToString(attr.DataType)) + len(aws.ToString(attr.StringValue))
+	}
+	return n
+}
+
+// messageBody wraps the envelope into the JSON document consumers read from the queue.
+func messageBody(msg txoutbox.Envelope) (string, error) {
 	body, err := json.Marshal(struct {
 		Topic   string          `json:"topic"`
 		Key     *string         `json:"key,omitempty"`
@@ -41,12 +148,55 @@ func (s *SQSSender) Send(ctx context.Context, msg txoutbox.Envelope) error {
 		Payload: msg.Payload,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
+	return string(body), nil
+}
 
-	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(s.queueURL),
-		MessageBody: aws.String(string(body)),
-	})
-	return err
+// maxMessageAttributes is the most message attributes SQS accepts per message.
+const maxMessageAttributes = 10
+
+// messageAttributes maps envelope headers to SQS string attributes. Headers SQS would reject (an invalid name or an
+// empty value) are skipped, and only the first ten remaining names in sorted order are kept, so a message with
+// unusual headers is still delivered instead of failing every attempt.
+func messageAttributes(headers map[string]string) map[string]types.MessageAttributeValue {
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if value != "" && validAttributeName(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	slices.Sort(names)
+	names = names[:min(len(names), maxMessageAttributes)]
+	attrs := make(map[string]types.MessageAttributeValue, len(names))
+	for _, name := range names {
+		attrs[name] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(headers[name]),
+		}
+	}
+	return attrs
+}
+
+// validAttributeName applies the SQS naming rules: up to 256 of A-Z, a-z, 0-9, '_', '-' and '.', no leading,
+// trailing or doubled '.', and no reserved "AWS." or "Amazon." prefix.
+func validAttributeName(name string) bool {
+	if name == "" || len(name) > 256 || name[0] == '.' || name[len(name)-1] == '.' || strings.Contains(name, "..") {
+		return false
+	}
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon.") {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
 }
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mickamy/txoutbox"
@@ -34,6 +36,12 @@ func (s *WebhookSender) Send(ctx context.Context, msg txoutbox.Envelope) error {
 	if err != nil {
 		return err
 	}
+	for name, value := range msg.Headers {
+		// net/http refuses to send a malformed header, which would fail every attempt until MaxAttempts.
+		if validHeaderName(name) && validHeaderValue(value) {
+			req.Header.Set(name, value)
+		}
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.client.Do(req)
@@ -41,8 +49,67 @@ func (s *WebhookSender) Send(ctx context.Context, msg txoutbox.Envelope) error {
 		return err
 	}
 	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook responded with %s", resp.Status)
+	return classifyResponse(resp)
+}
+
+// classifyResponse maps HTTP statuses onto txoutbox retry semantics: 429/503 honor Retry-After, other 4xx
+// responses (except 408) can never succeed and fail the message immediately.
+func classifyResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	err := fmt.Errorf("webhook responded with %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return txoutbox.RetryAfter(err, d)
+		}
+		return err
+	case resp.StatusCode == http.StatusRequestTimeout:
+		return err
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return txoutbox.Permanent(err)
+	default:
+		return err
+	}
+}
+
+// parseRetryAfter understands both delay-seconds and HTTP-date forms of the Retry-After header.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// validHeaderName reports whether name is an RFC 9110 token, the only form net/http accepts for header names.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue reports whether value is free of the control characters net/http refuses to send.
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
 	}
-	return nil
+	return true
 }
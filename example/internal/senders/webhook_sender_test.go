@@ -0,0 +1,35 @@
+package senders
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mickamy/txoutbox"
+)
+
+func TestWebhookSenderSkipsInvalidHeaders(t *testing.T) {
+	got := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	env := txoutbox.Envelope{ID: 1, Topic: "order.created", Headers: map[string]string{
+		"X-Tenant-Id": "acme",
+		"Bad Name":    "dropped",
+		"X-Injected":  "a\r\nb",
+	}}
+	if err := NewWebhook(srv.URL).Send(context.Background(), env); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	header := <-got
+	if header.Get("X-Tenant-Id") != "acme" {
+		t.Fatalf("X-Tenant-Id = %q, want acme", header.Get("X-Tenant-Id"))
+	}
+	if header.Get("X-Injected") != "" || header.Get("Bad Name") != "" {
+		t.Fatalf("invalid headers were sent: %v", header)
+	}
+}
@@ -0,0 +1,150 @@
+package txoutbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// heartbeat extends the leases of a claimed batch every HeartbeatInterval until each envelope has been handled,
+// so sends running longer than LeaseTTL are not re-claimed by another relay.
+type heartbeat struct {
+	relay *Relay
+	// mu guards pending and the entries it holds.
+	mu      sync.Mutex
+	pending map[int64]*heartbeatEntry
+	// stop ends the extension loop; done is closed once it has returned.
+	stop chan struct{}
+	done chan struct{}
+}
+
+// heartbeatEntry tracks one envelope whose lease is kept alive.
+type heartbeatEntry struct {
+	env Envelope
+	// lost is set once an extension reported ErrLeaseLost.
+	lost bool
+	// cancel aborts the send with ErrLeaseLost as cause; nil until the send starts.
+	cancel context.CancelCauseFunc
+}
+
+// startHeartbeat begins extending the leases of envelopes; callers must call halt once the batch is handled.
+func (r *Relay) startHeartbeat(ctx context.Context, envelopes []Envelope) *heartbeat {
+	h := &heartbeat{
+		relay:   r,
+		pending: make(map[int64]*heartbeatEntry, len(envelopes)),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, env := range envelopes {
+		h.pending[env.ID] = &heartbeatEntry{env: env}
+	}
+	if r.opts.HeartbeatInterval <= 0 {
+		close(h.done)
+		return h
+	}
+	go h.run(ctx)
+	return h
+}
+
+func (h *heartbeat) run(ctx context.Context) {
+	defer close(h.done)
+	ticker := time.NewTicker(h.relay.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.extend(ctx)
+		}
+	}
+}
+
+// extend renews every lease still pending, cancelling the sends whose lease turned out to be lost.
+func (h *heartbeat) extend(ctx context.Context) {
+	h.mu.Lock()
+	entries := make([]*heartbeatEntry, 0, len(h.pending))
+	for _, e := range h.pending {
+		if !e.lost {
+			entries = append(entries, e)
+		}
+	}
+	h.mu.Unlock()
+
+	r := h.relay
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		err := r.store.ExtendLease(ctx, e.env.Lease(), r.opts.LeaseTTL)
+		if err == nil {
+			continue
+		}
+		h.mu.Lock()
+		// An envelope finished while its extension was in flight has been acknowledged; the error is moot.
+		_, pending := h.pending[e.env.ID]
+		lost := pending && errors.Is(err, ErrLeaseLost)
+		if lost {
+			e.lost = true
+			if e.cancel != nil {
+				e.cancel(ErrLeaseLost)
+			}
+		}
+		h.mu.Unlock()
+		switch {
+		case !pending:
+		case lost:
+			r.opts.Logger.Warn(ctx, "lease on message %d held by %s was lost, cancelling its send", e.env.ID, e.env.ClaimedBy)
+			r.opts.Hooks.OnLeaseLost(ctx, e.env, "extend")
+		default:
+			r.opts.Logger.Error(ctx, "extend lease failed id=%d: %v", e.env.ID, err)
+			r.opts.Hooks.OnStoreError(ctx, "extend", e.env.ID, err)
+		}
+	}
+}
+
+// begin derives the context for sending env, reporting false when its lease was already lost.
+func (h *heartbeat) begin(ctx context.Context, env Envelope) (context.Context, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := h.pending[env.ID]
+	if e.lost {
+		return nil, false
+	}
+	ctx, e.cancel = context.WithCancelCause(ctx)
+	return ctx, true
+}
+
+// finish stops extending env's lease once its send has returned, before the outcome is acknowledged.
+func (h *heartbeat) finish(env Envelope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e := h.pending[env.ID]; e.cancel != nil {
+		e.cancel(nil)
+	}
+	delete(h.pending, env.ID)
+}
+
+// lost reports whether an extension found the lease on the envelope with the given ID lost.
+func (h *heartbeat) lost(id int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.pending[id]
+	return ok && e.lost
+}
+
+// halt stops the extension loop, waits for it to return and releases the contexts of envelopes never finished.
+func (h *heartbeat) halt() {
+	close(h.stop)
+	<-h.done
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.pending {
+		if e.cancel != nil {
+			e.cancel(nil)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package txoutbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Purger is implemented by stores that can remove finished messages.
+// Each call deletes at most limit rows so a single statement never holds locks on a large range.
+type Purger interface {
+	// PurgeSent deletes up to limit sent messages delivered before the cutoff, returning how many rows were removed.
+	PurgeSent(ctx context.Context, before time.Time, limit int) (int64, error)
+	// PurgeFailed deletes up to limit failed messages whose final attempt happened before the cutoff.
+	PurgeFailed(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// JanitorOptions configure retention for finished messages.
+type JanitorOptions struct {
+	// SentRetention is how long sent messages are kept; zero keeps them forever.
+	SentRetention time.Duration
+	// FailedRetention is how long failed messages are kept for inspection; zero keeps them forever.
+	FailedRetention time.Duration
+	// ArchiveRetention is how long archived messages are kept; zero keeps them forever.
+	// It requires a store implementing ArchivePurger with an archive table; otherwise Run returns an error instead of
+	// retrying every Interval.
+	ArchiveRetention time.Duration
+	// BatchSize caps how many rows a single purge statement deletes.
+	BatchSize int
+	// Interval is the sleep duration between purge cycles.
+	Interval time.Duration
+	// Logger emits logs for janitor activity.
+	Logger Logger
+	// Hooks receive OnPurge after each cycle that removed rows.
+	Hooks Hooks
+	// Now supplies the current time; override for tests or custom time sources.
+	Now func() time.Time
+}
+
+func (o *JanitorOptions) setDefaults() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Logger == nil {
+		o.Logger = noopLogger{}
+	}
+	if o.Hooks == nil {
+		o.Hooks = noopHooks{}
+	}
+	o.Hooks = safeHooks{hooks: o.Hooks, logger: o.Logger}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+}
+
+// Janitor periodically deletes finished messages past their retention; run it alongside Relay.Run.
+type Janitor struct {
+	// store removes finished rows.
+	store Purger
+	// archive removes archived rows; nil when store does not implement ArchivePurger.
+	archive ArchivePurger
+	// opts hold retention and pacing settings.
+	opts JanitorOptions
+}
+
+// NewJanitor wires a Purger with the provided options.
+func NewJanitor(store Purger, opts JanitorOptions) *Janitor {
+	opts.setDefaults()
+	archive, _ := store.(ArchivePurger)
+	return &Janitor{
+		store:   store,
+		archive: archive,
+		opts:    opts,
+	}
+}
+
+// Run purges expired messages until the context is cancelled. It returns early when ArchiveRetention is set but the
+// store cannot purge an archive, since no later cycle would succeed either.
+func (j *Janitor) Run(ctx context.Context) error {
+	if j.opts.ArchiveRetention > 0 && j.archive == nil {
+		return fmt.Errorf("txoutbox: ArchiveRetention requires a store implementing ArchivePurger")
+	}
+	ticker := time.NewTicker(j.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.purgeOnce(ctx); err != nil {
+			if errors.Is(err, ErrNoArchive) {
+				return err
+			}
+			j.opts.Logger.Error(ctx, "janitor error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeOnce removes every message past its retention, one batch at a time.
+func (j *Janitor) purgeOnce(ctx context.Context) error {
+	now := j.opts.Now().UTC()
+	if j.opts.SentRetention > 0 {
+		if err := j.drain(ctx, "sent", now.Add(-j.opts.SentRetention), j.store.PurgeSent); err != nil {
+			return err
+		}
+	}
+	if j.opts.FailedRetention > 0 {
+		if err := j.drain(ctx, "failed", now.Add(-j.opts.FailedRetention), j.store.PurgeFailed); err != nil {
+			return err
+		}
+	}
+	if j.opts.ArchiveRetention > 0 {
+		if err := j.drain(ctx, "archived", now.Add(-j.opts.ArchiveRetention), j.archive.PurgeArchived); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drain repeats purge until a batch comes back short, reporting the total through Hooks.OnPurge.
+func (j *Janitor) drain(ctx context.Context, status string, before time.Time, purge func(context.Context, time.Time, int) (int64, error)) error {
+	var total int64
+	defer func() {
+		if total > 0 {
+			j.opts.Logger.Info(ctx, "purged %d %s messages older than %s", total, status, before.Format(time.RFC3339))
+			j.opts.Hooks.OnPurge(ctx, status, total)
+		}
+	}()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := purge(ctx, before, j.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		total += n
+		if n < int64(j.opts.BatchSize) {
+			return nil
+		}
+	}
+}
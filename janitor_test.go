@@ -0,0 +1,214 @@
+package txoutbox_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mickamy/txoutbox"
+)
+
+func TestJanitorPurgesInBatches(t *testing.T) {
+	t.Parallel()
+	fixed := time.Unix(1700000000, 0).UTC()
+	purger := &fakePurger{remaining: map[string]int64{"sent": 7, "failed": 2}}
+	hooks := &hookSpy{}
+	janitor := txoutbox.NewJanitor(purger, txoutbox.JanitorOptions{
+		SentRetention:   24 * time.Hour,
+		FailedRetention: 7 * 24 * time.Hour,
+		BatchSize:       3,
+		Interval:        time.Hour,
+		Hooks:           hooks,
+		Now:             func() time.Time { return fixed },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- janitor.Run(ctx)
+	}()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return hooks.purged["failed"] == 2
+	})
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run error = %v, want %v", err, context.Canceled)
+	}
+
+	purger.mu.Lock()
+	defer purger.mu.Unlock()
+	if got := purger.calls["sent"]; got != 3 {
+		t.Fatalf("PurgeSent calls = %d, want 3", got)
+	}
+	if got := purger.cutoffs["sent"]; !got.Equal(fixed.Add(-24 * time.Hour)) {
+		t.Fatalf("sent cutoff = %s, want %s", got, fixed.Add(-24*time.Hour))
+	}
+	if got := purger.cutoffs["failed"]; !got.Equal(fixed.Add(-7 * 24 * time.Hour)) {
+		t.Fatalf("failed cutoff = %s, want %s", got, fixed.Add(-7*24*time.Hour))
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if hooks.purged["sent"] != 7 {
+		t.Fatalf("purged sent = %d, want 7", hooks.purged["sent"])
+	}
+}
+
+func TestJanitorSkipsDisabledRetention(t *testing.T) {
+	t.Parallel()
+	purger := &fakePurger{remaining: map[string]int64{"sent": 5, "failed": 5}}
+	done := make(chan struct{})
+	purger.onCall = func(status string) {
+		if status == "sent" {
+			close(done)
+		}
+	}
+	janitor := txoutbox.NewJanitor(purger, txoutbox.JanitorOptions{
+		SentRetention: time.Hour,
+		Interval:      time.Hour,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = janitor.Run(ctx) }()
+	waitFor(t, done)
+	cancel()
+
+	purger.mu.Lock()
+	defer purger.mu.Unlock()
+	if purger.calls["failed"] != 0 {
+		t.Fatalf("PurgeFailed called %d times with retention disabled", purger.calls["failed"])
+	}
+}
+
+func TestJanitorPurgesArchive(t *testing.T) {
+	t.Parallel()
+	fixed := time.Unix(1700000000, 0).UTC()
+	purger := &fakeArchivePurger{fakePurger: fakePurger{remaining: map[string]int64{"archived": 4}}}
+	hooks := &hookSpy{}
+	janitor := txoutbox.NewJanitor(purger, txoutbox.JanitorOptions{
+		ArchiveRetention: 30 * 24 * time.Hour,
+		BatchSize:        3,
+		Interval:         time.Hour,
+		Hooks:            hooks,
+		Now:              func() time.Time { return fixed },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = janitor.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return hooks.purged["archived"] == 4
+	})
+	cancel()
+
+	purger.mu.Lock()
+	defer purger.mu.Unlock()
+	if got := purger.cutoffs["archived"]; !got.Equal(fixed.Add(-30 * 24 * time.Hour)) {
+		t.Fatalf("archived cutoff = %s, want %s", got, fixed.Add(-30*24*time.Hour))
+	}
+	if purger.calls["sent"] != 0 || purger.calls["failed"] != 0 {
+		t.Fatalf("purge calls = %v, want only archived", purger.calls)
+	}
+}
+
+func TestJanitorArchiveRetentionRequiresArchivePurger(t *testing.T) {
+	t.Parallel()
+	purger := &fakePurger{}
+	janitor := txoutbox.NewJanitor(purger, txoutbox.JanitorOptions{
+		SentRetention:    time.Hour,
+		ArchiveRetention: time.Hour,
+		Interval:         time.Hour,
+	})
+
+	err := janitor.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ArchivePurger") {
+		t.Fatalf("Run error = %v, want the missing ArchivePurger", err)
+	}
+	purger.mu.Lock()
+	defer purger.mu.Unlock()
+	if len(purger.calls) != 0 {
+		t.Fatalf("purge calls = %v, want none before the configuration is rejected", purger.calls)
+	}
+}
+
+func TestJanitorStopsWithoutArchiveTable(t *testing.T) {
+	t.Parallel()
+	purger := &fakeArchivePurger{fakePurger: fakePurger{remaining: map[string]int64{}}, err: txoutbox.ErrNoArchive}
+	logger := &logSpy{}
+	janitor := txoutbox.NewJanitor(purger, txoutbox.JanitorOptions{
+		ArchiveRetention: time.Hour,
+		Interval:         time.Millisecond,
+		Logger:           logger,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+	if err := janitor.Run(ctx); !errors.Is(err, txoutbox.ErrNoArchive) {
+		t.Fatalf("Run error = %v, want %v", err, txoutbox.ErrNoArchive)
+	}
+	purger.mu.Lock()
+	defer purger.mu.Unlock()
+	if purger.calls["archived"] != 1 {
+		t.Fatalf("PurgeArchived calls = %d, want 1", purger.calls["archived"])
+	}
+}
+
+// fakePurger removes rows from an in-memory per-status counter.
+type fakePurger struct {
+	mu        sync.Mutex
+	remaining map[string]int64
+	calls     map[string]int
+	cutoffs   map[string]time.Time
+	onCall    func(status string)
+}
+
+func (p *fakePurger) PurgeSent(_ context.Context, before time.Time, limit int) (int64, error) {
+	return p.purge("sent", before, limit), nil
+}
+
+func (p *fakePurger) PurgeFailed(_ context.Context, before time.Time, limit int) (int64, error) {
+	return p.purge("failed", before, limit), nil
+}
+
+func (p *fakePurger) purge(status string, before time.Time, limit int) int64 {
+	p.mu.Lock()
+	if p.calls == nil {
+		p.calls = make(map[string]int)
+		p.cutoffs = make(map[string]time.Time)
+	}
+	p.calls[status]++
+	p.cutoffs[status] = before
+	n := min(p.remaining[status], int64(limit))
+	p.remaining[status] -= n
+	onCall := p.onCall
+	p.mu.Unlock()
+	if onCall != nil {
+		onCall(status)
+	}
+	return n
+}
+
+// fakeArchivePurger is a fakePurger whose store also runs in archive mode.
+type fakeArchivePurger struct {
+	fakePurger
+	// err is returned by every PurgeArchived call when set.
+	err error
+}
+
+func (p *fakeArchivePurger) PurgeArchived(_ context.Context, before time.Time, limit int) (int64, error) {
+	n := p.purge("archived", before, limit)
+	if p.err != nil {
+		return 0, p.err
+	}
+	return n, nil
+}
@@ -13,9 +13,18 @@ type Message struct {
 	// Topic identifies the logical event or routing destination (e.g. "order.created").
 	Topic string
 	// Key optionally provides a partition/idempotency key; leave empty if unused.
+	// Stores created with the ordered-keys option deliver messages sharing a key strictly in insertion order.
 	Key string
 	// Body is the user payload that will be marshaled to JSON.
 	Body any
+	// Headers carries metadata (correlation IDs, tenant, content type, ...) delivered alongside the payload.
+	Headers map[string]string
+	// DeliverAt optionally delays delivery until the given time; the zero value makes the message claimable at once.
+	DeliverAt time.Time
+	// DedupKey optionally makes enqueueing idempotent: Add returns ErrDuplicate instead of inserting when the outbox
+	// still holds a row with the same key (within the store's dedup window, if one is configured). Rows moved to the
+	// archive table or deleted by a Janitor no longer hold their key, so a retry after that enqueues the message again.
+	DedupKey string
 }
 
 // validate ensures the minimal contract for inserting an outbox row.
@@ -43,7 +52,7 @@ func (m Message) MarshalPayload() ([]byte, error) {
 
 // Envelope represents a row leased by the relay for delivery.
 type Envelope struct {
-	// ID is the primary key of the outbox row.
+	// ID is the primary key of the outbox row, as returned by Store.Add.
 	ID int64
 	// Topic is copied from the original Message for routing/logging.
 	Topic string
@@ -51,10 +60,25 @@ type Envelope struct {
 	Key *string
 	// Payload is the raw JSON message stored in the outbox.
 	Payload json.RawMessage
+	// Headers is the metadata stored with the original Message; nil when none was set.
+	Headers map[string]string
+	// Trace is the trace context captured by the store's Propagator when the message was added.
+	Trace TraceContext
 	// RetryCount tracks how many attempts have been made (before this lease).
 	RetryCount int
 	// CreatedAt records when the row was inserted.
 	CreatedAt time.Time
+	// ClaimedBy is the worker that holds the current lease.
+	ClaimedBy string
+	// LeaseToken is the claim generation issued by Claim and checked on every acknowledgement.
+	LeaseToken int64
+	// Supersedes counts the older messages with the same topic and key this one replaced on a coalesced topic.
+	Supersedes int
+}
+
+// Lease returns the fencing token identifying the claim this envelope was delivered under.
+func (e Envelope) Lease() Lease {
+	return Lease{ID: e.ID, WorkerID: e.ClaimedBy, Token: e.LeaseToken}
 }
 
 // Decode unmarshals the payload into the provided destination.
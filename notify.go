@@ -0,0 +1,61 @@
+package txoutbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Notifier wakes the Relay as soon as new messages may be claimable instead of waiting for the next poll.
+// Polling continues as a fallback, so a notifier only lowers latency and never has to be reliable.
+type Notifier interface {
+	// Listen returns a channel that receives a value whenever new messages may be ready. Bursts may be coalesced
+	// into a single value. The channel is closed once ctx is done.
+	Listen(ctx context.Context) (<-chan struct{}, error)
+}
+
+// LocalNotifier wakes relays in the same process. Producers call Notify after their transaction commits;
+// pass the notifier as Options.Notifier to every Relay that should react. It works with any Store.
+type LocalNotifier struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+// NewLocalNotifier returns a notifier without subscribers.
+func NewLocalNotifier() *LocalNotifier {
+	return &LocalNotifier{subs: make(map[chan struct{}]struct{})}
+}
+
+// Notify wakes every listening relay. It never blocks; notifications arriving before a relay catches up are
+// coalesced into one wake-up.
+func (n *LocalNotifier) Notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subs {
+		WakeUp(ch)
+	}
+}
+
+// Listen subscribes until ctx is done.
+func (n *LocalNotifier) Listen(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	n.subs[ch] = struct{}{}
+	n.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		n.mu.Lock()
+		delete(n.subs, ch)
+		n.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// WakeUp performs a non-blocking send on ch so bursts coalesce into a single pending wake-up. Notifier
+// implementations use it to feed the channel returned by Listen, which should have a buffer of one.
+func WakeUp(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
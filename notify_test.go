@@ -0,0 +1,73 @@
+package txoutbox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mickamy/txoutbox"
+)
+
+func TestLocalNotifierCoalescesAndFansOut(t *testing.T) {
+	t.Parallel()
+	notifier := txoutbox.NewLocalNotifier()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	first, err := notifier.Listen(ctx)
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	second, err := notifier.Listen(ctx)
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		notifier.Notify()
+	}
+	for _, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for wake-up")
+		}
+		select {
+		case <-ch:
+			t.Fatal("burst of notifications was not coalesced")
+		default:
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-first:
+		if ok {
+			t.Fatal("expected channel to be closed after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for channel close")
+	}
+}
+
+func TestLocalNotifierWakesRelay(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore(nil, []txoutbox.Envelope{{ID: 1, Topic: "topic"}})
+	notifier := txoutbox.NewLocalNotifier()
+	relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{
+		PollInterval: time.Hour,
+		Notifier:     notifier,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.claimQueue) == 1
+	})
+	notifier.Notify()
+	waitFor(t, store.sendCh)
+}
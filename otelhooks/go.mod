@@ -0,0 +1,19 @@
+module github.com/mickamy/txoutbox/otelhooks
+
+go 1.24.0
+
+replace github.com/mickamy/txoutbox => ..
+
+require (
+	github.com/mickamy/txoutbox v0.0.0
+	go.opentelemetry.io/otel v1.41.0
+	go.opentelemetry.io/otel/trace v1.41.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	go.opentelemetry.io/otel/metric v1.41.0 // indirect
+)
@@ -0,0 +1,172 @@
+// Package otelhooks integrates txoutbox with OpenTelemetry: it propagates W3C trace context through the outbox
+// and emits spans for relay activity.
+package otelhooks
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mickamy/txoutbox"
+)
+
+const instrumentationName = "github.com/mickamy/txoutbox/otelhooks"
+
+// Propagator adapts an OpenTelemetry TextMapPropagator to txoutbox.Propagator.
+// A nil p defaults to the W3C TraceContext propagator.
+func Propagator(p propagation.TextMapPropagator) txoutbox.Propagator {
+	if p == nil {
+		p = propagation.TraceContext{}
+	}
+	return propagator{p: p}
+}
+
+type propagator struct {
+	p propagation.TextMapPropagator
+}
+
+func (p propagator) Inject(ctx context.Context) txoutbox.TraceContext {
+	carrier := propagation.MapCarrier{}
+	p.p.Inject(ctx, carrier)
+	return txoutbox.TraceContext{
+		TraceParent: carrier.Get("traceparent"),
+		TraceState:  carrier.Get("tracestate"),
+	}
+}
+
+func (p propagator) Extract(ctx context.Context, tc txoutbox.TraceContext) context.Context {
+	carrier := propagation.MapCarrier{"traceparent": tc.TraceParent}
+	if tc.TraceState != "" {
+		carrier["tracestate"] = tc.TraceState
+	}
+	return p.p.Extract(ctx, carrier)
+}
+
+// Hooks implements txoutbox.Hooks by emitting spans for claims, sends, retries and failures.
+// Per-envelope spans are children of the trace restored by the relay's Propagator.
+//
+// Relay hooks fire once an operation has finished, so every span except the cycle span is a zero-length marker
+// placed at the moment the outcome was recorded; a send span does not measure how long the send took. The cycle
+// span is built from the duration OnCycle reports and covers the whole iteration.
+type Hooks struct {
+	tracer trace.Tracer
+}
+
+// NewHooks creates Hooks using tracers from tp; a nil tp uses the global TracerProvider.
+func NewHooks(tp trace.TracerProvider) *Hooks {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Hooks{tracer: tp.Tracer(instrumentationName)}
+}
+
+// OnClaim records a span describing how many rows were leased.
+func (h *Hooks) OnClaim(ctx context.Context, batchSize int, claimed int) {
+	_, span := h.tracer.Start(ctx, "txoutbox.claim", trace.WithAttributes(
+		attribute.Int("txoutbox.batch_size", batchSize),
+		attribute.Int("txoutbox.claimed", claimed),
+	))
+	span.End()
+}
+
+// OnSendSuccess records a successful delivery.
+func (h *Hooks) OnSendSuccess(ctx context.Context, env txoutbox.Envelope) {
+	_, span := h.startEnvelope(ctx, "txoutbox.send", env)
+	span.SetStatus(codes.Ok, "")
+	span.End()
+}
+
+// OnSendFailure records a delivery error before retry/fail handling.
+func (h *Hooks) OnSendFailure(ctx context.Context, env txoutbox.Envelope, err error) {
+	_, span := h.startEnvelope(ctx, "txoutbox.send", env)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+}
+
+// OnRetry records that the message was rescheduled.
+func (h *Hooks) OnRetry(ctx context.Context, env txoutbox.Envelope, nextAttempt int, delay time.Duration) {
+	_, span := h.startEnvelope(ctx, "txoutbox.retry", env)
+	span.SetAttributes(
+		attribute.Int("txoutbox.next_attempt", nextAttempt),
+		attribute.Int64("txoutbox.retry_delay_ms", delay.Milliseconds()),
+	)
+	span.End()
+}
+
+// OnFail records that the message was failed permanently.
+func (h *Hooks) OnFail(ctx context.Context, env txoutbox.Envelope, attempts int, err error) {
+	_, span := h.startEnvelope(ctx, "txoutbox.fail", env)
+	span.SetAttributes(attribute.Int("txoutbox.attempts", attempts))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+}
+
+// OnStoreError records a marker span for a failed store call, parented to the trace restored from ctx.
+func (h *Hooks) OnStoreError(ctx context.Context, op string, id int64, err error) {
+	_, span := h.tracer.Start(ctx, "txoutbox.store_error", trace.WithAttributes(
+		attribute.String("txoutbox.op", op),
+		attribute.Int64("txoutbox.id", id),
+	))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+}
+
+// OnLeaseLost records an acknowledgement rejected because the lease expired.
+func (h *Hooks) OnLeaseLost(ctx context.Context, env txoutbox.Envelope, op string) {
+	_, span := h.startEnvelope(ctx, "txoutbox.lease_lost", env)
+	span.SetAttributes(attribute.String("txoutbox.op", op))
+	span.End()
+}
+
+// OnCycle records a span covering the whole processOnce iteration.
+func (h *Hooks) OnCycle(ctx context.Context, duration time.Duration) {
+	end := time.Now()
+	_, span := h.tracer.Start(ctx, "txoutbox.cycle", trace.WithTimestamp(end.Add(-duration)))
+	span.End(trace.WithTimestamp(end))
+}
+
+// OnRelease records an envelope handed back to the store without an attempt.
+func (h *Hooks) OnRelease(ctx context.Context, env txoutbox.Envelope, reason string) {
+	_, span := h.startEnvelope(ctx, "txoutbox.release", env)
+	span.SetAttributes(attribute.String("txoutbox.reason", reason))
+	span.End()
+}
+
+// OnPollInterval is a no-op; the wait between cycles is visible as the gap between cycle spans.
+func (h *Hooks) OnPollInterval(context.Context, time.Duration) {}
+
+// OnPurge records a span for a janitor cycle that removed finished messages.
+func (h *Hooks) OnPurge(ctx context.Context, status string, removed int64) {
+	_, span := h.tracer.Start(ctx, "txoutbox.purge", trace.WithAttributes(
+		attribute.String("txoutbox.status", status),
+		attribute.Int64("txoutbox.removed", removed),
+	))
+	span.End()
+}
+
+// OnSuperseded records how many older messages a delivered envelope replaced on a coalesced topic.
+func (h *Hooks) OnSuperseded(ctx context.Context, env txoutbox.Envelope, count int) {
+	_, span := h.startEnvelope(ctx, "txoutbox.superseded", env)
+	span.SetAttributes(attribute.Int("txoutbox.superseded", count))
+	span.End()
+}
+
+func (h *Hooks) startEnvelope(ctx context.Context, name string, env txoutbox.Envelope) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.Int64("txoutbox.id", env.ID),
+		attribute.String("txoutbox.topic", env.Topic),
+		attribute.Int("txoutbox.retry_count", env.RetryCount),
+	}
+	if env.Key != nil {
+		attrs = append(attrs, attribute.String("txoutbox.key", *env.Key))
+	}
+	return h.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+}
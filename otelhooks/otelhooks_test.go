@@ -0,0 +1,158 @@
+package otelhooks_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/mickamy/txoutbox"
+	"github.com/mickamy/txoutbox/otelhooks"
+)
+
+func TestPropagatorRoundTrip(t *testing.T) {
+	t.Parallel()
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01, 0x02, 0x03},
+		SpanID:     trace.SpanID{0x04, 0x05},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	p := otelhooks.Propagator(nil)
+	tc := p.Inject(ctx)
+	if tc.IsZero() {
+		t.Fatal("Inject returned an empty trace context")
+	}
+
+	restored := trace.SpanContextFromContext(p.Extract(context.Background(), tc))
+	if restored.TraceID() != sc.TraceID() || restored.SpanID() != sc.SpanID() {
+		t.Fatalf("Extract span context = %v/%v, want %v/%v", restored.TraceID(), restored.SpanID(), sc.TraceID(), sc.SpanID())
+	}
+	if !restored.IsRemote() {
+		t.Fatal("expected extracted span context to be remote")
+	}
+
+	if tc := p.Inject(context.Background()); !tc.IsZero() {
+		t.Fatalf("Inject without span = %+v, want zero", tc)
+	}
+}
+
+func TestHooksEmitSpans(t *testing.T) {
+	t.Parallel()
+	tp := &recordingProvider{}
+	hooks := otelhooks.NewHooks(tp)
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a},
+		SpanID:     trace.SpanID{0x0b},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+	env := txoutbox.Envelope{ID: 7, Topic: "order.created"}
+
+	hooks.OnClaim(context.Background(), 10, 1)
+	hooks.OnSendFailure(ctx, env, errors.New("boom"))
+	hooks.OnRetry(ctx, env, 2, time.Second)
+	hooks.OnFail(ctx, env, 3, errors.New("boom"))
+	hooks.OnSendSuccess(ctx, env)
+
+	spans := tp.ended()
+	want := []string{"txoutbox.claim", "txoutbox.send", "txoutbox.retry", "txoutbox.fail", "txoutbox.send"}
+	if len(spans) != len(want) {
+		t.Fatalf("ended spans = %d, want %d", len(spans), len(want))
+	}
+	for i, span := range spans {
+		if span.name != want[i] {
+			t.Fatalf("span[%d] = %s, want %s", i, span.name, want[i])
+		}
+		if i > 0 && span.parent.TraceID() != parent.TraceID() {
+			t.Fatalf("span %s parent trace = %v, want %v", span.name, span.parent.TraceID(), parent.TraceID())
+		}
+	}
+}
+
+func TestHooksRecordStoreErrorsOnOwnSpan(t *testing.T) {
+	t.Parallel()
+	tp := &recordingProvider{}
+	hooks := otelhooks.NewHooks(tp)
+
+	// The relay hands over the non-recording remote span restored by the Propagator, which would drop the error.
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0c},
+		SpanID:     trace.SpanID{0x0d},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+	boom := errors.New("connection reset")
+	hooks.OnStoreError(ctx, "send", 7, boom)
+
+	spans := tp.ended()
+	if len(spans) != 1 || spans[0].name != "txoutbox.store_error" {
+		t.Fatalf("ended spans = %+v, want one txoutbox.store_error", spans)
+	}
+	span := spans[0]
+	if span.parent.TraceID() != parent.TraceID() {
+		t.Fatalf("store error parent trace = %v, want %v", span.parent.TraceID(), parent.TraceID())
+	}
+	if len(span.errs) != 1 || !errors.Is(span.errs[0], boom) || span.status != codes.Error {
+		t.Fatalf("recorded errors = %v, status = %v; want %v with an error status", span.errs, span.status, boom)
+	}
+}
+
+// recordingProvider captures the name and parent of every ended span.
+type recordingProvider struct {
+	noop.TracerProvider
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{provider: p}
+}
+
+func (p *recordingProvider) ended() []*recordedSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*recordedSpan(nil), p.spans...)
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	provider *recordingProvider
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{provider: t.provider, name: name, parent: trace.SpanContextFromContext(ctx)}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordedSpan struct {
+	noop.Span
+	provider *recordingProvider
+	name     string
+	parent   trace.SpanContext
+	errs     []error
+	status   codes.Code
+}
+
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.provider.mu.Lock()
+	defer s.provider.mu.Unlock()
+	s.provider.spans = append(s.provider.spans, s)
+}
@@ -2,14 +2,30 @@ package txoutbox
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Sender dispatches an outbox message to the actual transport.
+// Implementations must be safe for concurrent use when Options.Concurrency is greater than one.
+// Wrap returned errors with Permanent to skip remaining attempts, RetryAfter to override the Backoff delay, or
+// Release to hand the message back without counting an attempt.
 type Sender interface {
 	Send(ctx context.Context, msg Envelope) error
 }
 
+// ErrSendTimeout wraps the error of a Send cut short by Options.SendTimeout; the attempt is retried like any other
+// failure. The wrapped error still matches context.DeadlineExceeded when the Sender returned ctx.Err().
+var ErrSendTimeout = errors.New("txoutbox: send timed out")
+
+// ErrSenderPanic wraps the value recovered from a panicking Sender.Send, followed by the goroutine stack; the
+// attempt is retried or failed like any other error.
+var ErrSenderPanic = errors.New("txoutbox: sender panicked")
+
 // Logger captures Relay logs; implementors can wrap slog/zap/etc.
 type Logger interface {
 	Info(ctx context.Context, format string, v ...any)
@@ -18,6 +34,7 @@ type Logger interface {
 }
 
 // Hooks lets callers observe relay activity for metrics/tracing/logs.
+// When Options.Concurrency is greater than one, per-envelope hooks may be invoked from multiple goroutines.
 type Hooks interface {
 	// OnClaim fires after each Claim with the requested batch vs actual rows.
 	OnClaim(ctx context.Context, batchSize int, claimed int)
@@ -25,14 +42,29 @@ type Hooks interface {
 	OnSendSuccess(ctx context.Context, env Envelope)
 	// OnSendFailure fires when Sender returns an error before retry/fail handling.
 	OnSendFailure(ctx context.Context, env Envelope, err error)
-	// OnRetry fires when a message is rescheduled for another attempt.
+	// OnRetry fires when a message is rescheduled for another attempt; delay reflects any RetryAfter override.
 	OnRetry(ctx context.Context, env Envelope, nextAttempt int, delay time.Duration)
-	// OnFail fires when a message is permanently failed.
+	// OnFail fires when a message is permanently failed, either because attempts ran out or because
+	// the Sender returned a Permanent error (check with IsPermanent).
 	OnFail(ctx context.Context, env Envelope, attempts int, err error)
 	// OnStoreError fires when a Store call returns an error.
 	OnStoreError(ctx context.Context, op string, id int64, err error)
+	// OnLeaseLost fires when an acknowledgement is rejected because another worker re-claimed the row, or with op
+	// "extend" when the heartbeat finds the lease lost and cancels the send.
+	OnLeaseLost(ctx context.Context, env Envelope, op string)
 	// OnCycle fires once per processOnce iteration with the elapsed duration.
 	OnCycle(ctx context.Context, duration time.Duration)
+	// OnPollInterval fires before the relay waits for the next cycle with the chosen interval; zero means
+	// the previous batch came back full and the relay claims again immediately.
+	OnPollInterval(ctx context.Context, interval time.Duration)
+	// OnRelease fires for every envelope handed back to the store without an attempt; reason is "shutdown"
+	// when a Shutdown deadline or Run's context cut the batch short, or "sender" when the Sender returned Release.
+	OnRelease(ctx context.Context, env Envelope, reason string)
+	// OnPurge fires when a Janitor removes finished messages with the given status ("sent", "failed" or "archived").
+	OnPurge(ctx context.Context, status string, removed int64)
+	// OnSuperseded fires after OnSendSuccess for an envelope on a coalesced topic that replaced count older
+	// messages with the same key; those were marked 'superseded' by the store and never sent.
+	OnSuperseded(ctx context.Context, env Envelope, count int)
 }
 
 // Backoff returns the wait duration before the given attempt.
@@ -68,16 +100,35 @@ type Options struct {
 	BatchSize int
 	// LeaseTTL defines how long a claimed message stays owned before expiring.
 	LeaseTTL time.Duration
+	// HeartbeatInterval is how often leases of a batch still being processed are extended by another LeaseTTL.
+	// It defaults to a third of LeaseTTL; a negative value disables extension.
+	HeartbeatInterval time.Duration
 	// MaxAttempts is the number of total send tries before marking as failed.
 	MaxAttempts int
-	// PollInterval is the sleep duration between claim cycles when no work exists.
+	// PollInterval is the sleep duration between claim cycles after a partial batch.
+	// A full batch is followed by another claim right away.
 	PollInterval time.Duration
+	// MaxPollInterval caps the interval, which doubles from PollInterval after every empty or failed cycle.
+	MaxPollInterval time.Duration
+	// Concurrency bounds how many envelopes of a claimed batch are delivered in parallel; 1 keeps delivery sequential.
+	// Envelopes sharing a Key are always delivered one after another in claim order. A BatchSender receives the
+	// whole batch in one call instead.
+	Concurrency int
+	// SendTimeout bounds each Sender.Send call, or each BatchSender.SendBatch call as a whole (using the largest
+	// timeout among the batch's topics); zero leaves sends bounded only by Run's context.
+	SendTimeout time.Duration
+	// TopicSendTimeouts overrides SendTimeout for individual topics; a non-positive value disables the timeout.
+	TopicSendTimeouts map[string]time.Duration
 	// Backoff computes the retry delay based on attempt count.
 	Backoff Backoff
 	// Logger emits structured logs for relay activity.
 	Logger Logger
-	// Hooks let callers plug metrics/tracing/etc. into relay events.
+	// Hooks let callers plug metrics/tracing/etc. into relay events; a panicking hook is logged and ignored.
 	Hooks Hooks
+	// Notifier optionally wakes the relay as soon as new messages are committed; PollInterval still applies as a fallback.
+	Notifier Notifier
+	// Propagator restores the trace context captured at Add onto the context passed to Sender and per-envelope Hooks.
+	Propagator Propagator
 	// WorkerID identifies this relay instance in the database.
 	WorkerID string
 	// Now supplies the current time; override for tests or custom time sources.
@@ -91,12 +142,24 @@ func (o *Options) setDefaults() {
 	if o.LeaseTTL <= 0 {
 		o.LeaseTTL = 30 * time.Second
 	}
+	if o.HeartbeatInterval == 0 {
+		o.HeartbeatInterval = o.LeaseTTL / 3
+	}
 	if o.MaxAttempts <= 0 {
 		o.MaxAttempts = 10
 	}
 	if o.PollInterval <= 0 {
 		o.PollInterval = 500 * time.Millisecond
 	}
+	if o.MaxPollInterval <= 0 {
+		o.MaxPollInterval = 10 * o.PollInterval
+	}
+	if o.MaxPollInterval < o.PollInterval {
+		o.MaxPollInterval = o.PollInterval
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
 	if o.Backoff == nil {
 		o.Backoff = Exponential(500*time.Millisecond, 2.0, 30*time.Second)
 	}
@@ -106,6 +169,10 @@ func (o *Options) setDefaults() {
 	if o.Hooks == nil {
 		o.Hooks = noopHooks{}
 	}
+	o.Hooks = safeHooks{hooks: o.Hooks, logger: o.Logger}
+	if o.Propagator == nil {
+		o.Propagator = noopPropagator{}
+	}
 	if o.WorkerID == "" {
 		o.WorkerID = randomWorkerID()
 	}
@@ -122,89 +189,420 @@ type Relay struct {
 	sender Sender
 	// opts hold tuning parameters for the worker.
 	opts Options
+	// wake carries Notify calls to Run; buffered so bursts coalesce.
+	wake chan struct{}
+
+	// running is set once Run starts; done is closed when it returns.
+	running  atomic.Bool
+	done     chan struct{}
+	doneOnce sync.Once
+	// stopping is closed by Shutdown so Run stops claiming.
+	stopping chan struct{}
+	stopOnce sync.Once
+	// abortCtx is cancelled when the Shutdown deadline passes, cancelling in-flight sends.
+	abortCtx context.Context
+	abort    context.CancelFunc
+	// shutdownReleased counts rows handed back because a Shutdown deadline or Run's context cut a batch short;
+	// releases requested by senders are not included.
+	shutdownReleased atomic.Int64
 }
 
 // NewRelay wires a Store and Sender with the provided options.
 func NewRelay(store Store, sender Sender, opts Options) *Relay {
 	opts.setDefaults()
+	abortCtx, abort := context.WithCancel(context.Background())
 	return &Relay{
-		store:  store,
-		sender: sender,
-		opts:   opts,
+		store:    store,
+		sender:   sender,
+		opts:     opts,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopping: make(chan struct{}),
+		abortCtx: abortCtx,
+		abort:    abort,
 	}
 }
 
-// Run processes messages until the context is cancelled.
+// Notify makes Run claim immediately instead of waiting for the next poll, e.g. right after a producer in the
+// same process commits. It never blocks, and calls made while a cycle is running coalesce into one more cycle.
+func (r *Relay) Notify() {
+	WakeUp(r.wake)
+}
+
+// Shutdown stops Run from claiming new batches and waits for the batch in progress to finish.
+// If ctx expires first, in-flight sends are cancelled and envelopes of the batch that were not started yet are
+// released so other relays can claim them at once; Shutdown then waits for Run to return and reports ctx.Err().
+// It returns how many rows the cut-short batch released, excluding messages senders handed back with
+// Release, and does nothing when Run has not been started.
+func (r *Relay) Shutdown(ctx context.Context) (int64, error) {
+	r.stopOnce.Do(func() { close(r.stopping) })
+	if !r.running.Load() {
+		return 0, nil
+	}
+	select {
+	case <-r.done:
+		return r.shutdownReleased.Load(), nil
+	case <-ctx.Done():
+		r.abort()
+		<-r.done
+		return r.shutdownReleased.Load(), ctx.Err()
+	}
+}
+
+// Run processes messages until the context is cancelled or Shutdown is called, in which case it returns nil.
+// Cancelling ctx aborts the batch in progress like an expired Shutdown deadline; prefer Shutdown for deploys.
 func (r *Relay) Run(ctx context.Context) error {
-	ticker := time.NewTicker(r.opts.PollInterval)
-	defer ticker.Stop()
+	r.running.Store(true)
+	defer r.doneOnce.Do(func() { close(r.done) })
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(r.abortCtx, cancel)
+	defer stop()
+
+	timer := time.NewTimer(r.opts.PollInterval)
+	defer timer.Stop()
+
+	var wake <-chan struct{}
+	if r.opts.Notifier != nil {
+		ch, err := r.opts.Notifier.Listen(ctx)
+		if err != nil {
+			r.opts.Logger.Error(ctx, "notifier unavailable, falling back to polling: %v", err)
+		} else {
+			wake = ch
+		}
+	}
 
+	var interval time.Duration
 	for {
-		if err := r.processOnce(ctx); err != nil {
+		if r.stopped() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		claimed, err := r.processOnce(ctx)
+		if err != nil {
 			r.opts.Logger.Error(ctx, "relay error: %v", err)
 		}
+		interval = r.nextInterval(interval, claimed, err)
+		r.opts.Hooks.OnPollInterval(ctx, interval)
+		if interval == 0 {
+			continue
+		}
 
+		timer.Reset(interval)
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
+		case <-r.stopping:
+		case <-timer.C:
+		case <-r.wake:
+		case _, ok := <-wake:
+			if !ok {
+				wake = nil
+			}
 		}
 	}
 }
 
-// processOnce claims at most BatchSize messages and attempts delivery.
-func (r *Relay) processOnce(ctx context.Context) error {
+// stopped reports whether Shutdown has been called.
+func (r *Relay) stopped() bool {
+	select {
+	case <-r.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// nextInterval picks how long to wait after a cycle: nothing after a full batch, PollInterval after a partial
+// one, and an interval doubling up to MaxPollInterval while the table is empty or the store keeps failing.
+func (r *Relay) nextInterval(prev time.Duration, claimed int, err error) time.Duration {
+	switch {
+	case err != nil || claimed == 0:
+		if prev == 0 {
+			return r.opts.PollInterval
+		}
+		return min(2*prev, r.opts.MaxPollInterval)
+	case claimed >= r.opts.BatchSize:
+		return 0
+	default:
+		return r.opts.PollInterval
+	}
+}
+
+// processOnce claims at most BatchSize messages and attempts delivery, returning how many were attempted.
+func (r *Relay) processOnce(ctx context.Context) (int, error) {
 	start := time.Now()
 	envelopes, err := r.store.Claim(ctx, r.opts.WorkerID, r.opts.BatchSize, r.opts.LeaseTTL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	r.opts.Hooks.OnClaim(ctx, r.opts.BatchSize, len(envelopes))
 	if len(envelopes) == 0 {
 		r.opts.Hooks.OnCycle(ctx, time.Since(start))
-		return nil
+		return 0, nil
+	}
+
+	var (
+		mu        sync.Mutex
+		unstarted []Envelope
+		released  atomic.Int64
+	)
+	hb := r.startHeartbeat(ctx, envelopes)
+	acks := r.newAckBatch()
+	if bs, ok := r.sender.(BatchSender); ok {
+		if ctx.Err() != nil {
+			unstarted = envelopes
+		} else {
+			released.Add(int64(r.deliverBatch(ctx, bs, envelopes, hb, acks)))
+		}
+	} else {
+		r.dispatch(envelopes, func(env Envelope) {
+			if ctx.Err() != nil {
+				mu.Lock()
+				unstarted = append(unstarted, env)
+				mu.Unlock()
+				return
+			}
+			if !r.deliver(ctx, env, hb, acks) {
+				released.Add(1)
+			}
+		})
+	}
+	hb.halt()
+	r.flushAcks(context.WithoutCancel(ctx), acks, hb)
+	if len(unstarted) > 0 {
+		r.release(context.WithoutCancel(ctx), unstarted, "shutdown")
+	}
+	r.opts.Hooks.OnCycle(ctx, time.Since(start))
+	// Released envelopes are immediately claimable again; counting them would turn a paused topic into a busy loop.
+	return len(envelopes) - int(released.Load()), nil
+}
+
+// release hands envelopes that were never attempted back to the store.
+func (r *Relay) release(ctx context.Context, envelopes []Envelope, reason string) {
+	leases := make([]Lease, len(envelopes))
+	for i, env := range envelopes {
+		leases[i] = env.Lease()
+	}
+	n, err := r.store.Release(ctx, leases)
+	if err != nil {
+		r.opts.Logger.Error(ctx, "release %d messages failed: %v", len(envelopes), err)
+		for _, env := range envelopes {
+			r.opts.Hooks.OnStoreError(ctx, "release", env.ID, err)
+		}
+		return
+	}
+	if reason == "shutdown" {
+		r.shutdownReleased.Add(n)
+	}
+	r.opts.Logger.Info(ctx, "released %d unprocessed messages (%s)", n, reason)
+	for _, env := range envelopes {
+		r.opts.Hooks.OnRelease(ctx, env, reason)
 	}
+}
 
-	now := r.opts.Now().UTC()
+// dispatch runs fn for every envelope, spreading the batch over at most Concurrency goroutines.
+// Envelopes sharing a Key are handled sequentially in claim order. It returns once every envelope has been handled.
+func (r *Relay) dispatch(envelopes []Envelope, fn func(Envelope)) {
+	chains := chainByKey(envelopes)
+	workers := min(r.opts.Concurrency, len(chains))
+	if workers <= 1 {
+		for _, env := range envelopes {
+			fn(env)
+		}
+		return
+	}
+
+	jobs := make(chan []Envelope)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chain := range jobs {
+				for _, env := range chain {
+					fn(env)
+				}
+			}
+		}()
+	}
+	for _, chain := range chains {
+		jobs <- chain
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// chainByKey groups envelopes sharing a Key into chains that preserve claim order; keyless envelopes stand alone.
+func chainByKey(envelopes []Envelope) [][]Envelope {
+	chains := make([][]Envelope, 0, len(envelopes))
+	index := make(map[string]int)
 	for _, env := range envelopes {
-		if err := r.sender.Send(ctx, env); err != nil {
-			r.opts.Hooks.OnSendFailure(ctx, env, err)
-			r.handleFailure(ctx, env, err)
+		if env.Key == nil {
+			chains = append(chains, []Envelope{env})
 			continue
 		}
-		if err := r.store.Send(ctx, env.ID, now); err != nil {
-			r.opts.Logger.Error(ctx, "mark sent failed id=%d: %v", env.ID, err)
-			r.opts.Hooks.OnStoreError(ctx, "send", env.ID, err)
+		if i, ok := index[*env.Key]; ok {
+			chains[i] = append(chains[i], env)
 			continue
 		}
-		r.opts.Hooks.OnSendSuccess(ctx, env)
+		index[*env.Key] = len(chains)
+		chains = append(chains, []Envelope{env})
 	}
-	r.opts.Hooks.OnCycle(ctx, time.Since(start))
-	return nil
+	return chains
+}
+
+// deliver sends a single envelope and acknowledges the outcome in the store.
+// It reports false when the Sender declined the envelope with Release.
+func (r *Relay) deliver(ctx context.Context, env Envelope, hb *heartbeat, acks *ackBatch) bool {
+	if !env.Trace.IsZero() {
+		ctx = r.opts.Propagator.Extract(ctx, env.Trace)
+	}
+	ctx, ok := hb.begin(ctx, env)
+	if !ok {
+		// The lease expired before the send started; another relay owns the row now.
+		return true
+	}
+	sendCtx := ctx
+	timeout := r.sendTimeout(env.Topic)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeoutCause(ctx, timeout, ErrSendTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := r.send(sendCtx, env)
+	if acks == nil {
+		// Coalesced acks are written after the batch, so their leases stay under the heartbeat until then.
+		hb.finish(env)
+	}
+	if errors.Is(context.Cause(ctx), ErrLeaseLost) {
+		// The heartbeat already reported the lost lease, and any acknowledgement would be rejected.
+		return true
+	}
+	if err != nil && errors.Is(context.Cause(sendCtx), ErrSendTimeout) {
+		err = fmt.Errorf("%w after %s: %w", ErrSendTimeout, timeout, err)
+	}
+	return r.acknowledge(ctx, env, err, time.Since(start), acks)
+}
+
+// acknowledge records the outcome of a send in the store, or queues it on acks when the cycle coalesces them.
+// It reports false when the Sender declined the envelope.
+func (r *Relay) acknowledge(ctx context.Context, env Envelope, err error, took time.Duration, acks *ackBatch) bool {
+	attempt := Attempt{
+		Number:   env.RetryCount + 1,
+		At:       r.opts.Now().UTC(),
+		Duration: took,
+		Err:      err,
+	}
+	// Acknowledge even when the send was cut short by shutdown, so the row does not sit until its lease expires.
+	ctx = context.WithoutCancel(ctx)
+	if IsReleased(err) {
+		r.release(ctx, []Envelope{env}, "sender")
+		return false
+	}
+	if err != nil {
+		r.opts.Hooks.OnSendFailure(ctx, env, err)
+		r.handleFailure(ctx, env, attempt, acks)
+		return true
+	}
+	if acks != nil {
+		acks.add(&acks.sent, pendingAck{ctx: ctx, env: env, ack: Ack{Lease: env.Lease(), Attempt: attempt}})
+		return true
+	}
+	if err := r.store.Send(ctx, env.Lease(), attempt); err != nil {
+		r.handleStoreError(ctx, env, "send", err, nil)
+		return true
+	}
+	r.sent(ctx, env)
+	return true
+}
+
+// send calls the Sender, turning a panic into an error that carries the stack so the attempt is retried or failed.
+func (r *Relay) send(ctx context.Context, env Envelope) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%w: %v\n%s", ErrSenderPanic, rec, debug.Stack())
+		}
+	}()
+	return r.sender.Send(ctx, env)
+}
+
+// sendTimeout returns the Send deadline for topic, preferring TopicSendTimeouts over SendTimeout.
+func (r *Relay) sendTimeout(topic string) time.Duration {
+	if d, ok := r.opts.TopicSendTimeouts[topic]; ok {
+		return d
+	}
+	return r.opts.SendTimeout
 }
 
 // handleFailure decides whether to retry or fail a message permanently.
-func (r *Relay) handleFailure(ctx context.Context, env Envelope, sendErr error) {
-	attempt := env.RetryCount + 1
-	if attempt >= r.opts.MaxAttempts {
-		if err := r.store.Fail(ctx, env.ID, attempt); err != nil {
-			r.opts.Logger.Error(ctx, "mark failed id=%d: %v (original err: %v)", env.ID, err, sendErr)
-			r.opts.Hooks.OnStoreError(ctx, "fail", env.ID, err)
+// With a non-nil acks the decision is queued for the end of the cycle instead of written right away.
+func (r *Relay) handleFailure(ctx context.Context, env Envelope, attempt Attempt, acks *ackBatch) {
+	sendErr := attempt.Err
+	if attempt.Number >= r.opts.MaxAttempts || IsPermanent(sendErr) {
+		if acks != nil {
+			acks.add(&acks.failed, pendingAck{ctx: ctx, env: env, ack: Ack{Lease: env.Lease(), Attempt: attempt}})
+			return
+		}
+		if err := r.store.Fail(ctx, env.Lease(), attempt); err != nil {
+			r.handleStoreError(ctx, env, "fail", err, sendErr)
 		} else {
-			r.opts.Logger.Warn(ctx, "message %d failed permanently after %d attempts: %v", env.ID, attempt, sendErr)
-			r.opts.Hooks.OnFail(ctx, env, attempt, sendErr)
+			r.failed(ctx, env, attempt)
 		}
 		return
 	}
-	delay := r.opts.Backoff(attempt)
+	delay := r.opts.Backoff(attempt.Number)
+	if d, ok := RetryDelay(sendErr); ok {
+		delay = d
+	}
 	nextRetry := r.opts.Now().UTC().Add(delay)
-	if err := r.store.Retry(ctx, env.ID, attempt, nextRetry); err != nil {
-		r.opts.Logger.Error(ctx, "mark retry failed id=%d: %v (original err: %v)", env.ID, err, sendErr)
-		r.opts.Hooks.OnStoreError(ctx, "retry", env.ID, err)
+	if acks != nil {
+		acks.add(&acks.retried, pendingAck{ctx: ctx, env: env, ack: Ack{Lease: env.Lease(), Attempt: attempt, NextRetry: nextRetry}, delay: delay})
+		return
+	}
+	if err := r.store.Retry(ctx, env.Lease(), attempt, nextRetry); err != nil {
+		r.handleStoreError(ctx, env, "retry", err, sendErr)
 		return
 	}
-	r.opts.Hooks.OnRetry(ctx, env, attempt, delay)
-	r.opts.Logger.Warn(ctx, "message %d scheduled for retry #%d in %s: %v", env.ID, attempt, delay, sendErr)
+	r.retried(ctx, env, attempt, delay)
+}
+
+// sent reports a message the store recorded as delivered, along with the older messages it superseded.
+func (r *Relay) sent(ctx context.Context, env Envelope) {
+	r.opts.Hooks.OnSendSuccess(ctx, env)
+	if env.Supersedes > 0 {
+		r.opts.Hooks.OnSuperseded(ctx, env, env.Supersedes)
+	}
+}
+
+// failed reports a message the store recorded as permanently failed.
+func (r *Relay) failed(ctx context.Context, env Envelope, attempt Attempt) {
+	r.opts.Logger.Warn(ctx, "message %d failed permanently after %d attempts: %v", env.ID, attempt.Number, attempt.Err)
+	r.opts.Hooks.OnFail(ctx, env, attempt.Number, attempt.Err)
+}
+
+// retried reports a message the store rescheduled for another attempt.
+func (r *Relay) retried(ctx context.Context, env Envelope, attempt Attempt, delay time.Duration) {
+	r.opts.Hooks.OnRetry(ctx, env, attempt.Number, delay)
+	r.opts.Logger.Warn(ctx, "message %d scheduled for retry #%d in %s: %v", env.ID, attempt.Number, delay, attempt.Err)
+}
+
+// handleStoreError reports a failed acknowledgement, separating lost leases from genuine store errors.
+func (r *Relay) handleStoreError(ctx context.Context, env Envelope, op string, err, sendErr error) {
+	if errors.Is(err, ErrLeaseLost) {
+		r.opts.Logger.Warn(ctx, "mark %s skipped id=%d: lease held by %s was lost", op, env.ID, env.ClaimedBy)
+		r.opts.Hooks.OnLeaseLost(ctx, env, op)
+		return
+	}
+	if sendErr != nil {
+		r.opts.Logger.Error(ctx, "mark %s failed id=%d: %v (original err: %v)", op, env.ID, err, sendErr)
+	} else {
+		r.opts.Logger.Error(ctx, "mark %s failed id=%d: %v", op, env.ID, err)
+	}
+	r.opts.Hooks.OnStoreError(ctx, op, env.ID, err)
 }
 
 // noopLogger discards all relay logs.
@@ -223,4 +621,9 @@ func (noopHooks) OnSendFailure(context.Context, Envelope, error)        {}
 func (noopHooks) OnRetry(context.Context, Envelope, int, time.Duration) {}
 func (noopHooks) OnFail(context.Context, Envelope, int, error)          {}
 func (noopHooks) OnStoreError(context.Context, string, int64, error)    {}
+func (noopHooks) OnLeaseLost(context.Context, Envelope, string)         {}
 func (noopHooks) OnCycle(context.Context, time.Duration)                {}
+func (noopHooks) OnPollInterval(context.Context, time.Duration)         {}
+func (noopHooks) OnRelease(context.Context, Envelope, string)           {}
+func (noopHooks) OnPurge(context.Context, string, int64)                {}
+func (noopHooks) OnSuperseded(context.Context, Envelope, int)           {}
@@ -3,7 +3,10 @@ package txoutbox_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -122,6 +125,83 @@ func TestRelayFailsAfterMaxAttempts(t *testing.T) {
 	}
 }
 
+func TestRelayFailsPermanentErrorImmediately(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 4, Topic: "topic"}})
+	sender := &fakeSender{err: txoutbox.Permanent(errors.New("bad request"))}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		MaxAttempts:  10,
+		PollInterval: 5 * time.Millisecond,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Run(ctx)
+	}()
+
+	waitFor(t, store.failCh)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Relay.Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	if len(store.failCalls) != 1 || store.failCalls[0].retryCount != 1 {
+		t.Fatalf("fail calls = %+v, want one call with retryCount 1", store.failCalls)
+	}
+	if len(store.retryCalls) != 0 {
+		t.Fatalf("retry calls = %d, want 0", len(store.retryCalls))
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.failErrs) != 1 || !txoutbox.IsPermanent(hooks.failErrs[0]) {
+		t.Fatalf("OnFail errors = %v, want one permanent error", hooks.failErrs)
+	}
+}
+
+func TestRelayHonorsRetryAfter(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 5, Topic: "topic"}})
+	sender := &fakeSender{err: txoutbox.RetryAfter(errors.New("too many requests"), 42*time.Second)}
+	hooks := &hookSpy{}
+	fixed := time.Unix(1700000000, 0)
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		MaxAttempts:  5,
+		Backoff:      func(int) time.Duration { return time.Second },
+		Now:          func() time.Time { return fixed },
+		PollInterval: 5 * time.Millisecond,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Run(ctx)
+	}()
+
+	waitFor(t, store.retryCh)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Relay.Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	if len(store.retryCalls) != 1 {
+		t.Fatalf("retry calls = %d, want 1", len(store.retryCalls))
+	}
+	if want := fixed.UTC().Add(42 * time.Second); !store.retryCalls[0].nextRetry.Equal(want) {
+		t.Fatalf("nextRetry = %v, want %v", store.retryCalls[0].nextRetry, want)
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.retryDelays) != 1 || hooks.retryDelays[0] != 42*time.Second {
+		t.Fatalf("OnRetry delays = %v, want [42s]", hooks.retryDelays)
+	}
+}
+
 func TestRelayEmitsHooksOnSuccess(t *testing.T) {
 	t.Parallel()
 	store := newFakeStore([]txoutbox.Envelope{{ID: 11, Topic: "topic"}})
@@ -246,29 +326,295 @@ func TestRelayHooksStoreError(t *testing.T) {
 	}
 }
 
+func TestRelayHooksLeaseLost(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 41, Topic: "topic", ClaimedBy: "worker-stale", LeaseToken: 1}})
+	store.sendErr = fmt.Errorf("%w: id=41", txoutbox.ErrLeaseLost)
+	sender := &fakeSender{}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		BatchSize:    1,
+		PollInterval: 5 * time.Millisecond,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Run(ctx)
+	}()
+
+	waitFor(t, store.sendCh)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Relay.Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.leaseLost) != 1 || hooks.leaseLost[0] != "send" {
+		t.Fatalf("leaseLost = %v, want [send]", hooks.leaseLost)
+	}
+	if len(hooks.storeErrors) != 0 {
+		t.Fatalf("storeErrors = %d, want 0", len(hooks.storeErrors))
+	}
+	if hooks.sendSuccess != 0 {
+		t.Fatalf("sendSuccess = %d, want 0", hooks.sendSuccess)
+	}
+}
+
+func TestRelayConcurrentDelivery(t *testing.T) {
+	t.Parallel()
+	const total = 20
+	batch := make([]txoutbox.Envelope, total)
+	for i := range batch {
+		batch[i] = txoutbox.Envelope{ID: int64(i + 1), Topic: "topic"}
+	}
+	store := newFakeStore(batch)
+	sender := &fakeSender{
+		delay: 5 * time.Millisecond,
+		errFor: func(env txoutbox.Envelope) error {
+			if env.ID%2 == 0 {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		BatchSize:    total,
+		Concurrency:  4,
+		MaxAttempts:  3,
+		PollInterval: 5 * time.Millisecond,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Run(ctx)
+	}()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return hooks.sendSuccess+hooks.retries == total
+	})
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Relay.Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	if sender.maxInFlight < 2 || sender.maxInFlight > 4 {
+		t.Fatalf("max in-flight sends = %d, want between 2 and 4", sender.maxInFlight)
+	}
+	if len(sender.calls) != total {
+		t.Fatalf("sender calls = %d, want %d", len(sender.calls), total)
+	}
+
+	acked := make(map[int64]int)
+	for _, call := range store.sendCalls {
+		acked[call.id]++
+	}
+	for _, call := range store.retryCalls {
+		acked[call.id]++
+	}
+	for id := int64(1); id <= total; id++ {
+		if acked[id] != 1 {
+			t.Fatalf("id=%d acknowledged %d times, want 1", id, acked[id])
+		}
+	}
+	if len(store.sendCalls) != total/2 || len(store.retryCalls) != total/2 {
+		t.Fatalf("send/retry calls = %d/%d, want %d/%d", len(store.sendCalls), len(store.retryCalls), total/2, total/2)
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if hooks.sendSuccess != total/2 || hooks.sendFailure != total/2 || hooks.retries != total/2 {
+		t.Fatalf("hook counts success=%d failure=%d retries=%d, want %d each",
+			hooks.sendSuccess, hooks.sendFailure, hooks.retries, total/2)
+	}
+	if len(hooks.storeErrors) != 0 {
+		t.Fatalf("storeErrors = %d, want 0", len(hooks.storeErrors))
+	}
+}
+
+func TestRelayConcurrentDeliveryPreservesKeyOrder(t *testing.T) {
+	t.Parallel()
+	const total = 12
+	keys := []string{"a", "b", "c"}
+	batch := make([]txoutbox.Envelope, total)
+	for i := range batch {
+		key := keys[i%len(keys)]
+		batch[i] = txoutbox.Envelope{ID: int64(i + 1), Topic: "topic", Key: &key}
+	}
+	store := newFakeStore(batch)
+	sender := &keyedSender{delay: 2 * time.Millisecond, inFlight: make(map[string]int), order: make(map[string][]int64)}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		BatchSize:    total,
+		Concurrency:  total,
+		PollInterval: 5 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Run(ctx)
+	}()
+
+	waitUntil(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.sendCalls) == total
+	})
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Relay.Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	if sender.overlaps != 0 {
+		t.Fatalf("overlapping sends for the same key = %d, want 0", sender.overlaps)
+	}
+	for key, ids := range sender.order {
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Fatalf("key %s delivered out of order: %v", key, ids)
+			}
+		}
+	}
+}
+
+// keyedSender records per-key delivery order and flags concurrent sends for the same key.
+type keyedSender struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	inFlight map[string]int
+	order    map[string][]int64
+	overlaps int
+}
+
+func (s *keyedSender) Send(_ context.Context, msg txoutbox.Envelope) error {
+	key := *msg.Key
+	s.mu.Lock()
+	s.inFlight[key]++
+	if s.inFlight[key] > 1 {
+		s.overlaps++
+	}
+	s.order[key] = append(s.order[key], msg.ID)
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	s.inFlight[key]--
+	s.mu.Unlock()
+	return nil
+}
+
+func TestRelayRestoresTraceContext(t *testing.T) {
+	t.Parallel()
+	tc := txoutbox.TraceContext{TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+	store := newFakeStore([]txoutbox.Envelope{{ID: 51, Topic: "topic", Trace: tc}})
+	sender := &ctxSender{sendCh: make(chan struct{}, 1)}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval: 5 * time.Millisecond,
+		Propagator:   ctxPropagator{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Run(ctx)
+	}()
+
+	waitFor(t, sender.sendCh)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Relay.Run() error = %v, want %v", err, context.Canceled)
+	}
+
+	if sender.trace != tc {
+		t.Fatalf("sender trace context = %+v, want %+v", sender.trace, tc)
+	}
+}
+
+type traceKey struct{}
+
+// ctxPropagator stores the trace context as a plain context value.
+type ctxPropagator struct{}
+
+func (ctxPropagator) Inject(ctx context.Context) txoutbox.TraceContext {
+	tc, _ := ctx.Value(traceKey{}).(txoutbox.TraceContext)
+	return tc
+}
+
+func (ctxPropagator) Extract(ctx context.Context, tc txoutbox.TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// ctxSender records the trace context visible to Send.
+type ctxSender struct {
+	trace  txoutbox.TraceContext
+	sendCh chan struct{}
+}
+
+func (s *ctxSender) Send(ctx context.Context, _ txoutbox.Envelope) error {
+	s.trace = ctxPropagator{}.Inject(ctx)
+	s.sendCh <- struct{}{}
+	return nil
+}
+
 type fakeSender struct {
+	mu     sync.Mutex
 	err    error
+	errFor func(txoutbox.Envelope) error
+	delay  time.Duration
 	calls  []txoutbox.Envelope
 	sendCh chan struct{}
+
+	inFlight    int
+	maxInFlight int
 }
 
 func (s *fakeSender) Send(_ context.Context, msg txoutbox.Envelope) error {
+	s.mu.Lock()
 	s.calls = append(s.calls, msg)
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
 	if s.sendCh != nil {
 		select {
 		case s.sendCh <- struct{}{}:
 		default:
 		}
 	}
+	if s.errFor != nil {
+		return s.errFor(msg)
+	}
 	return s.err
 }
 
 type fakeStore struct {
+	mu         sync.Mutex
 	claimQueue [][]txoutbox.Envelope
 
-	sendErr  error
-	retryErr error
-	failErr  error
+	sendErr   error
+	retryErr  error
+	failErr   error
+	extendErr error
 
 	sendCalls []struct {
 		id     int64
@@ -283,6 +629,8 @@ type fakeStore struct {
 		id         int64
 		retryCount int
 	}
+	released []int64
+	extended []int64
 
 	sendCh  chan struct{}
 	retryCh chan struct{}
@@ -298,11 +646,13 @@ func newFakeStore(claims ...[]txoutbox.Envelope) *fakeStore {
 	}
 }
 
-func (f *fakeStore) Add(context.Context, txoutbox.Executor, txoutbox.Message) error {
-	return nil
+func (f *fakeStore) Add(context.Context, txoutbox.Executor, txoutbox.Message) (int64, error) {
+	return 0, nil
 }
 
 func (f *fakeStore) Claim(context.Context, string, int, time.Duration) ([]txoutbox.Envelope, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if len(f.claimQueue) == 0 {
 		return nil, nil
 	}
@@ -311,11 +661,13 @@ func (f *fakeStore) Claim(context.Context, string, int, time.Duration) ([]txoutb
 	return resp, nil
 }
 
-func (f *fakeStore) Send(_ context.Context, id int64, sendAt time.Time) error {
+func (f *fakeStore) Send(_ context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.sendCalls = append(f.sendCalls, struct {
 		id     int64
 		sendAt time.Time
-	}{id: id, sendAt: sendAt})
+	}{id: lease.ID, sendAt: attempt.At})
 	select {
 	case f.sendCh <- struct{}{}:
 	default:
@@ -326,7 +678,9 @@ func (f *fakeStore) Send(_ context.Context, id int64, sendAt time.Time) error {
 	return nil
 }
 
-func (f *fakeStore) Retry(_ context.Context, id int64, retryCount int, nextRetry time.Time) error {
+func (f *fakeStore) Retry(_ context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt, nextRetry time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.retryErr != nil {
 		return f.retryErr
 	}
@@ -334,7 +688,7 @@ func (f *fakeStore) Retry(_ context.Context, id int64, retryCount int, nextRetry
 		id         int64
 		retryCount int
 		nextRetry  time.Time
-	}{id: id, retryCount: retryCount, nextRetry: nextRetry})
+	}{id: lease.ID, retryCount: attempt.Number, nextRetry: nextRetry})
 	select {
 	case f.retryCh <- struct{}{}:
 	default:
@@ -342,14 +696,16 @@ func (f *fakeStore) Retry(_ context.Context, id int64, retryCount int, nextRetry
 	return nil
 }
 
-func (f *fakeStore) Fail(_ context.Context, id int64, retryCount int) error {
+func (f *fakeStore) Fail(_ context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.failErr != nil {
 		return f.failErr
 	}
 	f.failCalls = append(f.failCalls, struct {
 		id         int64
 		retryCount int
-	}{id: id, retryCount: retryCount})
+	}{id: lease.ID, retryCount: attempt.Number})
 	select {
 	case f.failCh <- struct{}{}:
 	default:
@@ -357,64 +713,1029 @@ func (f *fakeStore) Fail(_ context.Context, id int64, retryCount int) error {
 	return nil
 }
 
-func waitFor(t *testing.T, ch <-chan struct{}) {
-	t.Helper()
-	select {
-	case <-ch:
-	case <-time.After(2 * time.Second):
-		t.Fatal("timeout waiting for channel")
-	}
+func (f *fakeStore) ExtendLease(_ context.Context, lease txoutbox.Lease, _ time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.extended = append(f.extended, lease.ID)
+	return f.extendErr
 }
 
-type hookSpy struct {
-	mu          sync.Mutex
-	claims      []claimMetric
-	sendSuccess int
-	sendFailure int
-	retries     int
-	fails       int
-	storeErrors []storeError
-	cycles      int
+func (f *fakeStore) Release(_ context.Context, leases []txoutbox.Lease) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, lease := range leases {
+		f.released = append(f.released, lease.ID)
+	}
+	return int64(len(leases)), nil
 }
 
-type claimMetric struct {
-	batch   int
-	claimed int
-}
+func TestRelayWakesOnNotifier(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore(nil, []txoutbox.Envelope{{ID: 1, Topic: "topic"}})
+	notifier := &fakeNotifier{ch: make(chan struct{}, 1)}
+	relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{
+		PollInterval: time.Hour,
+		Notifier:     notifier,
+	})
 
-type storeError struct {
-	op string
-	id int64
-}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
 
-func (m *hookSpy) OnClaim(_ context.Context, batchSize int, claimed int) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.claims = append(m.claims, claimMetric{batch: batchSize, claimed: claimed})
+	waitUntil(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.claimQueue) == 1
+	})
+	notifier.ch <- struct{}{}
+	waitFor(t, store.sendCh)
 }
 
-func (m *hookSpy) OnSendSuccess(context.Context, txoutbox.Envelope) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.sendSuccess++
-}
+func TestRelayPollsWhenNotifierFails(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore(nil, []txoutbox.Envelope{{ID: 1, Topic: "topic"}})
+	relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{
+		PollInterval: 5 * time.Millisecond,
+		Notifier:     &fakeNotifier{err: errors.New("listen failed")},
+	})
 
-func (m *hookSpy) OnSendFailure(context.Context, txoutbox.Envelope, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.sendFailure++
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitFor(t, store.sendCh)
 }
 
-func (m *hookSpy) OnRetry(context.Context, txoutbox.Envelope, int, time.Duration) {
+func TestRelayNotifyWakesRun(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore(nil, []txoutbox.Envelope{{ID: 1, Topic: "topic"}})
+	relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{PollInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.claimQueue) == 1
+	})
+	relay.Notify()
+	relay.Notify()
+	waitFor(t, store.sendCh)
+}
+
+func TestRelayDrainsFullBatchesWithoutWaiting(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore(
+		[]txoutbox.Envelope{{ID: 1}, {ID: 2}},
+		[]txoutbox.Envelope{{ID: 3}, {ID: 4}},
+		[]txoutbox.Envelope{{ID: 5}},
+	)
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{
+		BatchSize:    2,
+		PollInterval: time.Hour,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 3
+	})
+	store.mu.Lock()
+	if len(store.sendCalls) != 5 {
+		t.Fatalf("expected 5 sends, got %d", len(store.sendCalls))
+	}
+	store.mu.Unlock()
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	want := []time.Duration{0, 0, time.Hour}
+	if len(hooks.intervals) != len(want) {
+		t.Fatalf("intervals = %v, want %v", hooks.intervals, want)
+	}
+	for i, d := range want {
+		if hooks.intervals[i] != d {
+			t.Fatalf("intervals = %v, want %v", hooks.intervals, want)
+		}
+	}
+}
+
+func TestRelayBacksOffWhenIdle(t *testing.T) {
+	t.Parallel()
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(newFakeStore(), &fakeSender{}, txoutbox.Options{
+		PollInterval:    time.Millisecond,
+		MaxPollInterval: 4 * time.Millisecond,
+		Hooks:           hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) >= 5
+	})
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond}
+	for i, d := range want {
+		if hooks.intervals[i] != d {
+			t.Fatalf("intervals = %v, want prefix %v", hooks.intervals, want)
+		}
+	}
+}
+
+func TestRelayShutdownFinishesBatch(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1}, {ID: 2}, {ID: 3}}, []txoutbox.Envelope{{ID: 4}})
+	sender := &fakeSender{delay: 20 * time.Millisecond, sendCh: make(chan struct{}, 1)}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{PollInterval: time.Hour})
+
+	errc := make(chan error, 1)
+	go func() { errc <- relay.Run(context.Background()) }()
+	waitFor(t, sender.sendCh)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	released, err := relay.Shutdown(ctx)
+	if err != nil || released != 0 {
+		t.Fatalf("Shutdown = %d, %v; want 0, nil", released, err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error = %v, want nil", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sendCalls) != 3 {
+		t.Fatalf("expected the whole batch to be acknowledged, got %d sends", len(store.sendCalls))
+	}
+	if len(store.claimQueue) != 1 {
+		t.Fatalf("relay claimed after Shutdown")
+	}
+}
+
+func TestRelayShutdownDeadlineReleasesUnstarted(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1}, {ID: 2}, {ID: 3}})
+	sender := &blockingSender{started: make(chan struct{}, 1)}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{PollInterval: time.Hour, Hooks: hooks})
+
+	errc := make(chan error, 1)
+	go func() { errc <- relay.Run(context.Background()) }()
+	waitFor(t, sender.started)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	released, err := relay.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if released != 2 {
+		t.Fatalf("released = %d, want 2", released)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error = %v, want nil", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.retryCalls) != 1 || store.retryCalls[0].id != 1 {
+		t.Fatalf("expected the cancelled send to be acknowledged as a retry, got %+v", store.retryCalls)
+	}
+	if len(store.released) != 2 || store.released[0] != 2 || store.released[1] != 3 {
+		t.Fatalf("released ids = %v, want [2 3]", store.released)
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.released) != 2 {
+		t.Fatalf("OnRelease calls = %v, want 2", hooks.released)
+	}
+}
+
+func TestRelayShutdownCountsOnlyShutdownReleases(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "paused"}, {ID: 2}, {ID: 3}})
+	sender := &blockingSender{started: make(chan struct{}, 1), releaseTopic: "paused"}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{PollInterval: time.Hour})
+
+	errc := make(chan error, 1)
+	go func() { errc <- relay.Run(context.Background()) }()
+	waitFor(t, sender.started)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	released, err := relay.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if released != 1 {
+		t.Fatalf("released = %d, want 1 (the sender release must not be counted)", released)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error = %v, want nil", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.released) != 2 || store.released[0] != 1 || store.released[1] != 3 {
+		t.Fatalf("released ids = %v, want [1 3]", store.released)
+	}
+}
+
+func TestRelayShutdownWithoutRun(t *testing.T) {
+	t.Parallel()
+	relay := txoutbox.NewRelay(newFakeStore(), &fakeSender{}, txoutbox.Options{})
+	if released, err := relay.Shutdown(context.Background()); err != nil || released != 0 {
+		t.Fatalf("Shutdown = %d, %v; want 0, nil", released, err)
+	}
+	if err := relay.Run(context.Background()); err != nil {
+		t.Fatalf("Run after Shutdown = %v, want nil", err)
+	}
+}
+
+// blockingSender blocks every send until its context is cancelled, except for envelopes of releaseTopic,
+// which it hands back with txoutbox.Release.
+type blockingSender struct {
+	started      chan struct{}
+	releaseTopic string
+}
+
+func (s *blockingSender) Send(ctx context.Context, env txoutbox.Envelope) error {
+	if s.releaseTopic != "" && env.Topic == s.releaseTopic {
+		return txoutbox.Release(errors.New("topic paused"))
+	}
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRelayReleasesWhenSenderDeclines(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "paused"}, {ID: 2, Topic: "live"}})
+	sender := &fakeSender{errFor: func(env txoutbox.Envelope) error {
+		if env.Topic == "paused" {
+			return txoutbox.Release(errors.New("topic paused"))
+		}
+		return nil
+	}}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		BatchSize:    2,
+		PollInterval: time.Hour,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.released) != 1 || store.released[0] != 1 {
+		t.Fatalf("released ids = %v, want [1]", store.released)
+	}
+	if len(store.sendCalls) != 1 || store.sendCalls[0].id != 2 {
+		t.Fatalf("sent = %+v, want only id=2", store.sendCalls)
+	}
+	if len(store.retryCalls) != 0 || len(store.failCalls) != 0 {
+		t.Fatalf("released message counted as an attempt: retries=%d fails=%d", len(store.retryCalls), len(store.failCalls))
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if hooks.sendFailure != 0 || len(hooks.released) != 1 {
+		t.Fatalf("hooks sendFailure=%d released=%v, want 0 and [1]", hooks.sendFailure, hooks.released)
+	}
+	if hooks.intervals[0] != time.Hour {
+		t.Fatalf("interval after a batch with a released message = %s, want %s", hooks.intervals[0], time.Hour)
+	}
+}
+
+func TestRelayExtendsLeaseDuringLongSend(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "upload"}})
+	relay := txoutbox.NewRelay(store, &fakeSender{delay: 50 * time.Millisecond}, txoutbox.Options{
+		PollInterval:      time.Hour,
+		HeartbeatInterval: 5 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitFor(t, store.sendCh)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.extended) == 0 {
+		t.Fatalf("lease was never extended during a send longer than the heartbeat interval")
+	}
+	for _, id := range store.extended {
+		if id != 1 {
+			t.Fatalf("extended ids = %v, want only 1", store.extended)
+		}
+	}
+}
+
+func TestRelayCancelsSendWhenLeaseLost(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "upload"}})
+	store.extendErr = txoutbox.ErrLeaseLost
+	hooks := &hookSpy{}
+	sender := &blockingSender{started: make(chan struct{}, 1)}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval:      time.Hour,
+		HeartbeatInterval: 5 * time.Millisecond,
+		Hooks:             hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitFor(t, sender.started)
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.leaseLost) != 1 || hooks.leaseLost[0] != "extend" {
+		t.Fatalf("leaseLost = %v, want [extend]", hooks.leaseLost)
+	}
+	if hooks.sendFailure != 0 {
+		t.Fatalf("sendFailure = %d, want 0 for a send cancelled by a lost lease", hooks.sendFailure)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sendCalls) != 0 || len(store.retryCalls) != 0 || len(store.failCalls) != 0 {
+		t.Fatalf("acknowledged a lost lease: sends=%d retries=%d fails=%d", len(store.sendCalls), len(store.retryCalls), len(store.failCalls))
+	}
+}
+
+func TestRelaySendTimeoutRetries(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "partner.api"}})
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, &blockingSender{started: make(chan struct{}, 1)}, txoutbox.Options{
+		PollInterval: time.Hour,
+		SendTimeout:  10 * time.Millisecond,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitFor(t, store.retryCh)
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.sendErrs) != 1 {
+		t.Fatalf("send failures = %d, want 1", len(hooks.sendErrs))
+	}
+	err := hooks.sendErrs[0]
+	if !errors.Is(err, txoutbox.ErrSendTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("send failure = %v, want ErrSendTimeout wrapping context.DeadlineExceeded", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.retryCalls) != 1 || len(store.failCalls) != 0 {
+		t.Fatalf("retries=%d fails=%d, want a single retry", len(store.retryCalls), len(store.failCalls))
+	}
+}
+
+type deadlineSender struct {
+	mu        sync.Mutex
+	deadlines map[string]time.Duration
+}
+
+func (s *deadlineSender) Send(ctx context.Context, env txoutbox.Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.deadlines[env.Topic] = time.Until(deadline)
+	} else {
+		s.deadlines[env.Topic] = 0
+	}
+	return nil
+}
+
+func TestRelayTopicSendTimeouts(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "default"}, {ID: 2, Topic: "upload"}, {ID: 3, Topic: "unbounded"}})
+	sender := &deadlineSender{deadlines: make(map[string]time.Duration)}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval:      time.Hour,
+		SendTimeout:       time.Minute,
+		TopicSendTimeouts: map[string]time.Duration{"upload": time.Hour, "unbounded": 0},
+		Hooks:             hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if d := sender.deadlines["default"]; d <= 0 || d > time.Minute {
+		t.Fatalf("default topic deadline in %s, want within SendTimeout", d)
+	}
+	if d := sender.deadlines["upload"]; d <= time.Minute || d > time.Hour {
+		t.Fatalf("upload topic deadline in %s, want the per-topic hour", d)
+	}
+	if d, ok := sender.deadlines["unbounded"]; !ok || d != 0 {
+		t.Fatalf("unbounded topic deadline in %s, want none", d)
+	}
+}
+
+type panicSender struct{}
+
+func (panicSender) Send(context.Context, txoutbox.Envelope) error {
+	panic("nil map write")
+}
+
+func TestRelayRecoversSenderPanic(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "topic"}})
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, panicSender{}, txoutbox.Options{
+		PollInterval: time.Hour,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitFor(t, store.retryCh)
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.sendErrs) != 1 {
+		t.Fatalf("send failures = %d, want 1", len(hooks.sendErrs))
+	}
+	err := hooks.sendErrs[0]
+	if !errors.Is(err, txoutbox.ErrSenderPanic) {
+		t.Fatalf("send failure = %v, want %v", err, txoutbox.ErrSenderPanic)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "nil map write") || !strings.Contains(msg, "goroutine") {
+		t.Fatalf("send failure %q lacks the panic value or stack", msg)
+	}
+}
+
+type logSpy struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (l *logSpy) Info(context.Context, string, ...any) {}
+func (l *logSpy) Warn(context.Context, string, ...any) {}
+func (l *logSpy) Error(_ context.Context, format string, v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, v...))
+}
+
+// panicHooks panics on every claim and successful send, on top of recording like hookSpy.
+type panicHooks struct {
+	*hookSpy
+}
+
+func (panicHooks) OnClaim(context.Context, int, int) {
+	panic("metrics backend down")
+}
+
+func (panicHooks) OnSendSuccess(context.Context, txoutbox.Envelope) {
+	panic("metrics backend down")
+}
+
+func TestRelayRecoversHookPanic(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "topic"}, {ID: 2, Topic: "topic"}})
+	hooks := &hookSpy{}
+	logger := &logSpy{}
+	relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{
+		PollInterval: time.Hour,
+		Hooks:        panicHooks{hooks},
+		Logger:       logger,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	store.mu.Lock()
+	sent := len(store.sendCalls)
+	store.mu.Unlock()
+	if sent != 2 {
+		t.Fatalf("store.Send calls = %d, want 2 despite panicking hooks", sent)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.errors) != 3 {
+		t.Fatalf("logged errors = %d, want one per panicking hook call (3)", len(logger.errors))
+	}
+	for _, msg := range logger.errors {
+		if !strings.Contains(msg, "panicked: metrics backend down") {
+			t.Fatalf("logged error %q, want the recovered panic", msg)
+		}
+	}
+}
+
+type fakeBatchSender struct {
+	fakeSender
+	batches [][]int64
+	results func([]txoutbox.Envelope) []error
+}
+
+func (s *fakeBatchSender) SendBatch(_ context.Context, envs []txoutbox.Envelope) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int64, len(envs))
+	for i, env := range envs {
+		ids[i] = env.ID
+	}
+	s.batches = append(s.batches, ids)
+	return s.results(envs)
+}
+
+func TestRelayUsesBatchSender(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1}, {ID: 2}, {ID: 3, RetryCount: 4}})
+	sender := &fakeBatchSender{results: func(envs []txoutbox.Envelope) []error {
+		return []error{nil, errors.New("throttled"), txoutbox.Permanent(errors.New("too large"))}
+	}}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval: time.Hour,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	sender.mu.Lock()
+	if len(sender.batches) != 1 || fmt.Sprint(sender.batches[0]) != "[1 2 3]" || len(sender.calls) != 0 {
+		t.Fatalf("batches = %v, single sends = %d; want one batch [1 2 3]", sender.batches, len(sender.calls))
+	}
+	sender.mu.Unlock()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sendCalls) != 1 || store.sendCalls[0].id != 1 {
+		t.Fatalf("sent = %+v, want id=1", store.sendCalls)
+	}
+	if len(store.retryCalls) != 1 || store.retryCalls[0].id != 2 {
+		t.Fatalf("retried = %+v, want id=2", store.retryCalls)
+	}
+	if len(store.failCalls) != 1 || store.failCalls[0].id != 3 || store.failCalls[0].retryCount != 5 {
+		t.Fatalf("failed = %+v, want id=3 after attempt 5", store.failCalls)
+	}
+}
+
+func TestRelayRetriesBatchWithMismatchedResults(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1}, {ID: 2}})
+	sender := &fakeBatchSender{results: func([]txoutbox.Envelope) []error { return nil }}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval: time.Hour,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sendCalls) != 0 || len(store.retryCalls) != 2 {
+		t.Fatalf("sends=%d retries=%d, want every envelope retried", len(store.sendCalls), len(store.retryCalls))
+	}
+}
+
+// blockingBatchSender blocks every SendBatch until its context is cancelled and records the cancellation cause.
+type blockingBatchSender struct {
+	blockingSender
+	mu    sync.Mutex
+	cause error
+}
+
+func (s *blockingBatchSender) SendBatch(ctx context.Context, envs []txoutbox.Envelope) []error {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	s.mu.Lock()
+	s.cause = context.Cause(ctx)
+	s.mu.Unlock()
+	errs := make([]error, len(envs))
+	for i := range errs {
+		errs[i] = ctx.Err()
+	}
+	return errs
+}
+
+func TestRelayBatchUsesLargestTopicTimeout(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "fast"}, {ID: 2, Topic: "slow"}})
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, &blockingBatchSender{blockingSender: blockingSender{started: make(chan struct{}, 1)}}, txoutbox.Options{
+		PollInterval:      time.Hour,
+		SendTimeout:       5 * time.Millisecond,
+		TopicSendTimeouts: map[string]time.Duration{"slow": 30 * time.Millisecond},
+		Hooks:             hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.sendErrs) != 2 {
+		t.Fatalf("send failures = %d, want 2", len(hooks.sendErrs))
+	}
+	for _, err := range hooks.sendErrs {
+		if !errors.Is(err, txoutbox.ErrSendTimeout) || !strings.Contains(err.Error(), "after 30ms") {
+			t.Fatalf("send failure = %v, want ErrSendTimeout after 30ms", err)
+		}
+	}
+}
+
+func TestRelayBatchWithoutTimeoutWhenTopicDisablesIt(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1, Topic: "fast"}, {ID: 2, Topic: "unbounded"}})
+	sender := &blockingBatchSender{blockingSender: blockingSender{started: make(chan struct{}, 1)}}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval:      time.Hour,
+		SendTimeout:       5 * time.Millisecond,
+		TopicSendTimeouts: map[string]time.Duration{"unbounded": 0},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitFor(t, sender.started)
+	time.Sleep(30 * time.Millisecond)
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if sender.cause != nil {
+		t.Fatalf("SendBatch was cancelled with %v, want no deadline", sender.cause)
+	}
+}
+
+func TestRelayBatchCancelledWhenAllLeasesLost(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{{ID: 1}, {ID: 2}})
+	store.extendErr = txoutbox.ErrLeaseLost
+	hooks := &hookSpy{}
+	sender := &blockingBatchSender{blockingSender: blockingSender{started: make(chan struct{}, 1)}}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval:      time.Hour,
+		HeartbeatInterval: 5 * time.Millisecond,
+		Hooks:             hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	sender.mu.Lock()
+	if !errors.Is(sender.cause, txoutbox.ErrLeaseLost) {
+		t.Fatalf("SendBatch cancellation cause = %v, want %v", sender.cause, txoutbox.ErrLeaseLost)
+	}
+	sender.mu.Unlock()
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if len(hooks.leaseLost) != 2 || hooks.sendFailure != 0 {
+		t.Fatalf("leaseLost = %v sendFailure = %d, want two lost leases and no failures", hooks.leaseLost, hooks.sendFailure)
+	}
+}
+
+type fakeBulkStore struct {
+	*fakeStore
+	bulkCalls map[string][][]int64
+	lost      map[int64]bool
+}
+
+func newFakeBulkStore(claims ...[]txoutbox.Envelope) *fakeBulkStore {
+	return &fakeBulkStore{fakeStore: newFakeStore(claims...), bulkCalls: make(map[string][][]int64), lost: make(map[int64]bool)}
+}
+
+func (f *fakeBulkStore) record(op string, acks []txoutbox.Ack) []txoutbox.Lease {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]int64, len(acks))
+	var lost []txoutbox.Lease
+	for i, ack := range acks {
+		ids[i] = ack.Lease.ID
+		if f.lost[ack.Lease.ID] {
+			lost = append(lost, ack.Lease)
+		}
+	}
+	f.bulkCalls[op] = append(f.bulkCalls[op], ids)
+	return lost
+}
+
+func (f *fakeBulkStore) SendMany(_ context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return f.record("send", acks), nil
+}
+
+func (f *fakeBulkStore) RetryMany(_ context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return f.record("retry", acks), nil
+}
+
+func (f *fakeBulkStore) FailMany(_ context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return f.record("fail", acks), nil
+}
+
+func TestRelayCoalescesAcknowledgements(t *testing.T) {
+	t.Parallel()
+	store := newFakeBulkStore([]txoutbox.Envelope{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5, RetryCount: 9}})
+	store.lost[2] = true
+	sender := &fakeSender{errFor: func(env txoutbox.Envelope) error {
+		if env.ID >= 4 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval: time.Hour,
+		Concurrency:  3,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sendCalls) != 0 || len(store.retryCalls) != 0 || len(store.failCalls) != 0 {
+		t.Fatalf("per-envelope acks used with a bulk store: sends=%d retries=%d fails=%d", len(store.sendCalls), len(store.retryCalls), len(store.failCalls))
+	}
+	for op, want := range map[string]int{"send": 3, "retry": 1, "fail": 1} {
+		calls := store.bulkCalls[op]
+		if len(calls) != 1 || len(calls[0]) != want {
+			t.Fatalf("%sMany calls = %v, want one call with %d acks", op, calls, want)
+		}
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	if hooks.sendSuccess != 2 || hooks.retries != 1 || hooks.fails != 1 {
+		t.Fatalf("hooks success=%d retries=%d fails=%d, want 2, 1, 1", hooks.sendSuccess, hooks.retries, hooks.fails)
+	}
+	if len(hooks.leaseLost) != 1 || hooks.leaseLost[0] != "send" {
+		t.Fatalf("leaseLost = %v, want [send]", hooks.leaseLost)
+	}
+}
+
+// countingStore counts the store calls issued to acknowledge a batch. A per-envelope call is one round-trip on a
+// real database; a bulk call is one transaction whose statement count does not grow with the batch.
+type countingStore struct {
+	txoutbox.Store
+	calls atomic.Int64
+}
+
+func (c *countingStore) Send(context.Context, txoutbox.Lease, txoutbox.Attempt) error {
+	c.calls.Add(1)
+	return nil
+}
+
+type countingBulkStore struct {
+	*countingStore
+}
+
+func (c countingBulkStore) SendMany(context.Context, []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	c.calls.Add(1)
+	return nil, nil
+}
+
+func (c countingBulkStore) RetryMany(context.Context, []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	c.calls.Add(1)
+	return nil, nil
+}
+
+func (c countingBulkStore) FailMany(context.Context, []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	c.calls.Add(1)
+	return nil, nil
+}
+
+func BenchmarkRelayAcknowledgements(b *testing.B) {
+	batch := make([]txoutbox.Envelope, 100)
+	for i := range batch {
+		batch[i] = txoutbox.Envelope{ID: int64(i + 1)}
+	}
+	claims := func(b *testing.B) [][]txoutbox.Envelope {
+		queue := make([][]txoutbox.Envelope, b.N)
+		for i := range queue {
+			queue[i] = batch
+		}
+		return queue
+	}
+	run := func(b *testing.B, store txoutbox.Store, counter *countingStore) {
+		hooks := &hookSpy{}
+		relay := txoutbox.NewRelay(store, &fakeSender{}, txoutbox.Options{BatchSize: len(batch), PollInterval: time.Hour, Hooks: hooks})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		b.ResetTimer()
+		go func() { _ = relay.Run(ctx) }()
+		for {
+			hooks.mu.Lock()
+			cycles := len(hooks.intervals)
+			hooks.mu.Unlock()
+			if cycles >= b.N {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(counter.calls.Load())/float64(b.N), "store-calls/op")
+	}
+
+	b.Run("per-envelope", func(b *testing.B) {
+		counter := &countingStore{Store: newFakeStore(claims(b)...)}
+		run(b, counter, counter)
+	})
+	b.Run("bulk", func(b *testing.B) {
+		counter := &countingStore{Store: newFakeStore(claims(b)...)}
+		run(b, countingBulkStore{counter}, counter)
+	})
+}
+
+func TestRelayReportsSupersededMessages(t *testing.T) {
+	t.Parallel()
+	store := newFakeStore([]txoutbox.Envelope{
+		{ID: 1, Topic: "entity.state", Supersedes: 3},
+		{ID: 2, Topic: "entity.state", Supersedes: 5},
+		{ID: 3, Topic: "entity.state"},
+	})
+	sender := &fakeSender{errFor: func(env txoutbox.Envelope) error {
+		if env.ID == 2 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}}
+	hooks := &hookSpy{}
+	relay := txoutbox.NewRelay(store, sender, txoutbox.Options{
+		PollInterval: time.Hour,
+		Hooks:        hooks,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = relay.Run(ctx) }()
+
+	waitUntil(t, func() bool {
+		hooks.mu.Lock()
+		defer hooks.mu.Unlock()
+		return len(hooks.intervals) == 1
+	})
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	// Only delivered envelopes count; the retried one reports once it is finally sent.
+	if hooks.superseded != 3 {
+		t.Fatalf("superseded = %d, want 3", hooks.superseded)
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for channel")
+	}
+}
+
+type hookSpy struct {
+	mu          sync.Mutex
+	claims      []claimMetric
+	sendSuccess int
+	sendFailure int
+	sendErrs    []error
+	retries     int
+	retryDelays []time.Duration
+	fails       int
+	failErrs    []error
+	storeErrors []storeError
+	leaseLost   []string
+	cycles      int
+	purged      map[string]int64
+	superseded  int
+	released    []int64
+	intervals   []time.Duration
+}
+
+type claimMetric struct {
+	batch   int
+	claimed int
+}
+
+type storeError struct {
+	op string
+	id int64
+}
+
+func (m *hookSpy) OnClaim(_ context.Context, batchSize int, claimed int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.claims = append(m.claims, claimMetric{batch: batchSize, claimed: claimed})
+}
+
+func (m *hookSpy) OnSendSuccess(context.Context, txoutbox.Envelope) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sendSuccess++
+}
+
+func (m *hookSpy) OnSendFailure(_ context.Context, _ txoutbox.Envelope, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sendFailure++
+	m.sendErrs = append(m.sendErrs, err)
+}
+
+func (m *hookSpy) OnRetry(_ context.Context, _ txoutbox.Envelope, _ int, delay time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.retries++
+	m.retryDelays = append(m.retryDelays, delay)
 }
 
-func (m *hookSpy) OnFail(context.Context, txoutbox.Envelope, int, error) {
+func (m *hookSpy) OnFail(_ context.Context, _ txoutbox.Envelope, _ int, err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.fails++
+	m.failErrs = append(m.failErrs, err)
 }
 
 func (m *hookSpy) OnStoreError(_ context.Context, op string, id int64, _ error) {
@@ -423,8 +1744,54 @@ func (m *hookSpy) OnStoreError(_ context.Context, op string, id int64, _ error)
 	m.storeErrors = append(m.storeErrors, storeError{op: op, id: id})
 }
 
+func (m *hookSpy) OnLeaseLost(_ context.Context, _ txoutbox.Envelope, op string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leaseLost = append(m.leaseLost, op)
+}
+
 func (m *hookSpy) OnCycle(context.Context, time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.cycles++
 }
+
+func (m *hookSpy) OnPollInterval(_ context.Context, interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.intervals = append(m.intervals, interval)
+}
+
+func (m *hookSpy) OnRelease(_ context.Context, env txoutbox.Envelope, _ string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.released = append(m.released, env.ID)
+}
+
+func (m *hookSpy) OnPurge(_ context.Context, status string, removed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.purged == nil {
+		m.purged = make(map[string]int64)
+	}
+	m.purged[status] += removed
+}
+
+func (m *hookSpy) OnSuperseded(_ context.Context, _ txoutbox.Envelope, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.superseded += count
+}
+
+// fakeNotifier hands out a test-controlled wake-up channel.
+type fakeNotifier struct {
+	ch  chan struct{}
+	err error
+}
+
+func (n *fakeNotifier) Listen(context.Context) (<-chan struct{}, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	return n.ch, nil
+}
@@ -0,0 +1,81 @@
+package txoutbox
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// safeHooks shields the relay and janitor from panicking Hooks: a panic is logged with its stack and the
+// operation that fired the hook carries on.
+type safeHooks struct {
+	hooks  Hooks
+	logger Logger
+}
+
+// recover logs a panic raised by the named hook; it must be deferred directly.
+func (h safeHooks) recover(ctx context.Context, name string) {
+	if rec := recover(); rec != nil {
+		h.logger.Error(ctx, "hook %s panicked: %v\n%s", name, rec, debug.Stack())
+	}
+}
+
+func (h safeHooks) OnClaim(ctx context.Context, batchSize int, claimed int) {
+	defer h.recover(ctx, "OnClaim")
+	h.hooks.OnClaim(ctx, batchSize, claimed)
+}
+
+func (h safeHooks) OnSendSuccess(ctx context.Context, env Envelope) {
+	defer h.recover(ctx, "OnSendSuccess")
+	h.hooks.OnSendSuccess(ctx, env)
+}
+
+func (h safeHooks) OnSendFailure(ctx context.Context, env Envelope, err error) {
+	defer h.recover(ctx, "OnSendFailure")
+	h.hooks.OnSendFailure(ctx, env, err)
+}
+
+func (h safeHooks) OnRetry(ctx context.Context, env Envelope, nextAttempt int, delay time.Duration) {
+	defer h.recover(ctx, "OnRetry")
+	h.hooks.OnRetry(ctx, env, nextAttempt, delay)
+}
+
+func (h safeHooks) OnFail(ctx context.Context, env Envelope, attempts int, err error) {
+	defer h.recover(ctx, "OnFail")
+	h.hooks.OnFail(ctx, env, attempts, err)
+}
+
+func (h safeHooks) OnStoreError(ctx context.Context, op string, id int64, err error) {
+	defer h.recover(ctx, "OnStoreError")
+	h.hooks.OnStoreError(ctx, op, id, err)
+}
+
+func (h safeHooks) OnLeaseLost(ctx context.Context, env Envelope, op string) {
+	defer h.recover(ctx, "OnLeaseLost")
+	h.hooks.OnLeaseLost(ctx, env, op)
+}
+
+func (h safeHooks) OnCycle(ctx context.Context, duration time.Duration) {
+	defer h.recover(ctx, "OnCycle")
+	h.hooks.OnCycle(ctx, duration)
+}
+
+func (h safeHooks) OnPollInterval(ctx context.Context, interval time.Duration) {
+	defer h.recover(ctx, "OnPollInterval")
+	h.hooks.OnPollInterval(ctx, interval)
+}
+
+func (h safeHooks) OnRelease(ctx context.Context, env Envelope, reason string) {
+	defer h.recover(ctx, "OnRelease")
+	h.hooks.OnRelease(ctx, env, reason)
+}
+
+func (h safeHooks) OnPurge(ctx context.Context, status string, removed int64) {
+	defer h.recover(ctx, "OnPurge")
+	h.hooks.OnPurge(ctx, status, removed)
+}
+
+func (h safeHooks) OnSuperseded(ctx context.Context, env Envelope, count int) {
+	defer h.recover(ctx, "OnSuperseded")
+	h.hooks.OnSuperseded(ctx, env, count)
+}
@@ -3,24 +3,107 @@ package txoutbox
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 )
 
-// Executor is the minimal surface needed from *sql.Tx or *sql.DB.
+// ErrLeaseLost is returned by Store acknowledgements when the row is no longer held by the given lease,
+// typically because the lease expired and another worker re-claimed it.
+var ErrLeaseLost = errors.New("txoutbox: lease lost")
+
+// ErrDuplicate is returned by Store.Add when a message with the same DedupKey is already enqueued. Nothing is
+// written, and the caller's transaction remains usable.
+var ErrDuplicate = errors.New("txoutbox: duplicate message")
+
+// Executor is the minimal surface needed from *sql.Tx, *sql.DB or *sql.Conn.
 type Executor interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Lease identifies a single claim on an outbox row and acts as a fencing token for acknowledgements.
+type Lease struct {
+	// ID is the primary key of the outbox row.
+	ID int64
+	// WorkerID is the relay instance that claimed the row.
+	WorkerID string
+	// Token is the claim generation; every Claim of the row increments it.
+	Token int64
+}
+
+// Canceler is implemented by stores that can withdraw messages before they are delivered.
+// Only pending or retry-scheduled rows are cancelled; rows currently leased by a relay are left untouched.
+type Canceler interface {
+	// Cancel marks the message as cancelled, reporting whether a row was withdrawn.
+	Cancel(ctx context.Context, exec Executor, id int64) (bool, error)
+	// CancelByKey marks every unclaimed message with the key as cancelled, returning how many rows were withdrawn.
+	CancelByKey(ctx context.Context, exec Executor, key string) (int64, error)
+}
+
+// BulkAdder is implemented by stores that can enqueue many messages with a handful of statements.
+type BulkAdder interface {
+	// AddMany enqueues msgs in slice order using exec (typically *sql.Tx). Every message is validated before
+	// anything is written, so one invalid message fails the whole call and nothing is enqueued. Messages whose
+	// DedupKey is already enqueued are skipped.
+	AddMany(ctx context.Context, exec Executor, msgs []Message) error
+}
+
+// Attempt describes a single delivery attempt reported alongside an acknowledgement.
+type Attempt struct {
+	// Number is the 1-based attempt count; Retry and Fail persist it as retry_count.
+	Number int
+	// At is when the attempt completed; Send persists it as sent_at and every acknowledgement as last_attempt_at.
+	At time.Time
+	// Duration is how long the Sender took.
+	Duration time.Duration
+	// Err is the error returned by the Sender; nil for successful deliveries.
+	Err error
 }
 
 // Store encapsulates DB operations used by the relay.
 type Store interface {
-	// Add enqueues a message using the provided transaction/executor (typically *sql.Tx).
-	Add(ctx context.Context, exec Executor, msg Message) error
+	// Add enqueues a message using the provided transaction/executor (typically *sql.Tx) and returns the ID of the
+	// new row, which later appears as Envelope.ID and can be passed to Canceler.Cancel.
+	// It returns ErrDuplicate when msg.DedupKey matches a message already enqueued.
+	Add(ctx context.Context, exec Executor, msg Message) (int64, error)
 	// Claim selects pending messages and leases them to a worker, returning envelopes to process.
 	Claim(ctx context.Context, workerID string, limit int, leaseTTL time.Duration) ([]Envelope, error)
 	// Send marks a message as successfully delivered.
-	Send(ctx context.Context, id int64, sendAt time.Time) error
-	// Retry releases the message to be retried later after incrementing the attempt counter.
-	Retry(ctx context.Context, id int64, retryCount int, nextRetry time.Time) error
-	// Fail flags the message as permanently failed so operators can inspect the row.
-	Fail(ctx context.Context, id int64, retryCount int) error
+	// It returns ErrLeaseLost when the row is no longer held by the lease.
+	Send(ctx context.Context, lease Lease, attempt Attempt) error
+	// Retry releases the message to be retried at nextRetry, recording the failed attempt and its error.
+	// It returns ErrLeaseLost when the row is no longer held by the lease.
+	Retry(ctx context.Context, lease Lease, attempt Attempt, nextRetry time.Time) error
+	// Fail flags the message as permanently failed, recording the final attempt so operators can inspect the row.
+	// It returns ErrLeaseLost when the row is no longer held by the lease.
+	Fail(ctx context.Context, lease Lease, attempt Attempt) error
+	// ExtendLease keeps a claimed row leased for another ttl, so a long-running send is not re-claimed.
+	// It returns ErrLeaseLost when the row is no longer held by the lease.
+	ExtendLease(ctx context.Context, lease Lease, ttl time.Duration) error
+	// Release hands claimed rows back without counting an attempt so they can be claimed again at once.
+	// Leases that no longer hold their row are skipped; it returns how many rows were released.
+	Release(ctx context.Context, leases []Lease) (int64, error)
+}
+
+// Ack is one acknowledgement passed to the bulk operations of a BulkAcknowledger.
+type Ack struct {
+	// Lease fences the acknowledgement like the lease passed to Send, Retry and Fail.
+	Lease Lease
+	// Attempt describes the delivery attempt being acknowledged.
+	Attempt Attempt
+	// NextRetry is when RetryMany makes the row claimable again; SendMany and FailMany ignore it.
+	NextRetry time.Time
+}
+
+// BulkAcknowledger is implemented by stores that can acknowledge many rows in one round-trip. When the relay's store
+// implements it, the outcomes of a cycle are recorded with at most one call of each method instead of one
+// Send, Retry or Fail per envelope.
+type BulkAcknowledger interface {
+	// SendMany marks the messages as delivered, returning the leases that no longer held their row.
+	SendMany(ctx context.Context, acks []Ack) ([]Lease, error)
+	// RetryMany schedules every message for another attempt at its NextRetry, returning the leases that no longer
+	// held their row.
+	RetryMany(ctx context.Context, acks []Ack) ([]Lease, error)
+	// FailMany flags the messages as permanently failed, returning the leases that no longer held their row.
+	FailMany(ctx context.Context, acks []Ack) ([]Lease, error)
 }
@@ -0,0 +1,153 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mickamy/txoutbox"
+	"github.com/mickamy/txoutbox/internal/sqlutil"
+)
+
+// archive moves sent rows into an archive table and queries them; only the dialect hooks differ between stores.
+type archive struct {
+	db        *sql.DB
+	table     string // already quoted; empty disables archive mode
+	source    string // already quoted outbox table
+	keyColumn string // already quoted
+	// placeholder renders the bind marker for the n-th (1-based) argument.
+	placeholder func(n int) string
+}
+
+// move returns the statements relocating a just-sent row into the archive, or nothing when archive mode is off.
+// They run after the fenced Send update, so the row is already locked by the acknowledging transaction.
+func (a archive) move(lease txoutbox.Lease) []statement {
+	if a.table == "" {
+		return nil
+	}
+	columns := fmt.Sprintf("id, topic, %s, payload, headers, traceparent, tracestate, retry_count, created_at, sent_at", a.keyColumn)
+	return []statement{
+		{
+			query: fmt.Sprintf(
+				"INSERT INTO %s (%s, claimed_by) SELECT %s, %s FROM %s WHERE id = %s",
+				a.table, columns, columns, a.placeholder(1), a.source, a.placeholder(2),
+			),
+			args: []any{lease.WorkerID, lease.ID},
+		},
+		{
+			query: fmt.Sprintf("DELETE FROM %s WHERE id = %s", a.source, a.placeholder(1)),
+			args:  []any{lease.ID},
+		},
+	}
+}
+
+// moveMany is move for many just-sent rows; rows are grouped by the worker that held them, which is normally one.
+func (a archive) moveMany(acks []txoutbox.Ack) []statement {
+	if a.table == "" {
+		return nil
+	}
+	var workers []string
+	byWorker := make(map[string][]int64)
+	for _, ack := range acks {
+		if _, ok := byWorker[ack.Lease.WorkerID]; !ok {
+			workers = append(workers, ack.Lease.WorkerID)
+		}
+		byWorker[ack.Lease.WorkerID] = append(byWorker[ack.Lease.WorkerID], ack.Lease.ID)
+	}
+	columns := fmt.Sprintf("id, topic, %s, payload, headers, traceparent, tracestate, retry_count, created_at, sent_at", a.keyColumn)
+	stmts := make([]statement, 0, len(workers)+1)
+	for _, worker := range workers {
+		args := []any{worker}
+		list := a.idList(byWorker[worker], &args)
+		stmts = append(stmts, statement{
+			query: fmt.Sprintf("INSERT INTO %s (%s, claimed_by) SELECT %s, %s FROM %s WHERE id IN (%s)", a.table, columns, columns, a.placeholder(1), a.source, list),
+			args:  args,
+		})
+	}
+	ids := make([]int64, len(acks))
+	for i, ack := range acks {
+		ids[i] = ack.Lease.ID
+	}
+	var args []any
+	list := a.idList(ids, &args)
+	return append(stmts, statement{query: fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", a.source, list), args: args})
+}
+
+// idList binds ids after the arguments already in args, returning their comma-separated markers.
+func (a archive) idList(ids []int64, args *[]any) string {
+	marks := make([]string, len(ids))
+	for i, id := range ids {
+		*args = append(*args, id)
+		marks[i] = a.placeholder(len(*args))
+	}
+	return strings.Join(marks, ", ")
+}
+
+func (a archive) list(ctx context.Context, filter txoutbox.ArchiveFilter, page txoutbox.Page) ([]txoutbox.ArchivedMessage, error) {
+	if a.table == "" {
+		return nil, txoutbox.ErrNoArchive
+	}
+	limit := page.Limit
+	if limit <= 0 {
+		limit = txoutbox.DefaultPageLimit
+	}
+	var args []any
+	bind := func(v any) string {
+		args = append(args, v)
+		return a.placeholder(len(args))
+	}
+	conds := []string{"id > " + bind(page.AfterID)}
+	if filter.Topic != "" {
+		conds = append(conds, "topic = "+bind(filter.Topic))
+	}
+	if filter.Key != "" {
+		conds = append(conds, a.keyColumn+" = "+bind(filter.Key))
+	}
+	if !filter.SentAfter.IsZero() {
+		conds = append(conds, "sent_at >= "+bind(filter.SentAfter.UTC()))
+	}
+	if !filter.SentBefore.IsZero() {
+		conds = append(conds, "sent_at < "+bind(filter.SentBefore.UTC()))
+	}
+	query := fmt.Sprintf(
+		"SELECT id, topic, %s, payload, headers, traceparent, tracestate, retry_count, created_at, claimed_by, sent_at FROM %s WHERE %s ORDER BY id LIMIT %s",
+		a.keyColumn, a.table, strings.Join(conds, " AND "), bind(limit),
+	)
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) { _ = rows.Close() }(rows)
+
+	var messages []txoutbox.ArchivedMessage
+	for rows.Next() {
+		var (
+			msg         txoutbox.ArchivedMessage
+			key         sql.NullString
+			payload     []byte
+			rawHeaders  []byte
+			traceParent sql.NullString
+			traceState  sql.NullString
+			claimedBy   sql.NullString
+		)
+		if err := rows.Scan(&msg.ID, &msg.Topic, &key, &payload, &rawHeaders, &traceParent, &traceState, &msg.RetryCount, &msg.CreatedAt, &claimedBy, &msg.SentAt); err != nil {
+			return nil, err
+		}
+		headers, err := decodeHeaders(rawHeaders)
+		if err != nil {
+			return nil, err
+		}
+		msg.Key = sqlutil.NullableString(key)
+		msg.Payload = bytes.Clone(payload)
+		msg.Headers = headers
+		msg.Trace = txoutbox.TraceContext{TraceParent: traceParent.String, TraceState: traceState.String}
+		msg.ClaimedBy = claimedBy.String
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,63 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/mickamy/txoutbox"
+)
+
+// maxErrorLength caps persisted error text so long messages (e.g. stack traces) fit in every dialect's TEXT type.
+const maxErrorLength = 8192
+
+// attemptError converts the attempt error into a nullable column value.
+func attemptError(err error) any {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if len(msg) > maxErrorLength {
+		msg = strings.ToValidUTF8(msg[:maxErrorLength], "")
+	}
+	return msg
+}
+
+// historyColumns lists the attempts table columns written by historyValues.
+const historyColumns = "message_id, attempt, worker_id, status, error, duration_ms, attempted_at"
+
+// historyValues returns the attempts table row for an acknowledgement with the given resulting status.
+func historyValues(lease txoutbox.Lease, attempt txoutbox.Attempt, status string) []any {
+	return []any{lease.ID, attempt.Number, lease.WorkerID, status, attemptError(attempt.Err), attempt.Duration.Milliseconds(), attempt.At}
+}
+
+// statement is a query and its arguments executed as part of an acknowledgement.
+type statement struct {
+	query string
+	args  []any
+}
+
+// acknowledge runs an acknowledgement UPDATE fenced by lease. Follow-up statements (attempt history, archive moves)
+// run in the same transaction so they never take effect for an acknowledgement that lost its lease.
+func acknowledge(ctx context.Context, db *sql.DB, lease txoutbox.Lease, update statement, followups ...statement) error {
+	if len(followups) == 0 {
+		res, err := db.ExecContext(ctx, update.query, update.args...)
+		return checkLease(res, err, lease)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, update.query, update.args...)
+	if err := checkLease(res, err, lease); err != nil {
+		return err
+	}
+	for _, stmt := range followups {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,222 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mickamy/txoutbox"
+)
+
+// bulkAcks implements the txoutbox.BulkAcknowledger skeleton shared by every store; only the dialect hooks differ.
+type bulkAcks struct {
+	db    *sql.DB
+	table string // already quoted
+	// placeholder renders the bind marker for the n-th (1-based) argument.
+	placeholder func(n int) string
+	// cast annotates a bind marker with its SQL type where the dialect cannot infer it inside CASE.
+	cast func(marker, sqlType string) string
+	// lock is appended to the lease lookup; empty on SQLite, whose write transactions are exclusive anyway.
+	lock string
+	// inIDs renders a condition matching the given ids, appending its arguments to args.
+	inIDs func(ids []int64, args []any) (string, []any)
+}
+
+// bulkSet builds the SET clause of a multi-row UPDATE, binding per-row values through CASE expressions.
+type bulkSet struct {
+	acks []txoutbox.Ack
+	args []any
+	b    bulkAcks
+}
+
+// each renders a CASE expression giving every row its own value.
+func (s *bulkSet) each(sqlType string, value func(txoutbox.Ack) any) string {
+	var sb strings.Builder
+	sb.WriteString("CASE id")
+	for _, ack := range s.acks {
+		s.args = append(s.args, ack.Lease.ID)
+		id := s.b.placeholder(len(s.args))
+		s.args = append(s.args, value(ack))
+		fmt.Fprintf(&sb, " WHEN %s THEN %s", id, s.b.cast(s.b.placeholder(len(s.args)), sqlType))
+	}
+	sb.WriteString(" END")
+	return sb.String()
+}
+
+// bulkRowParams is the most values any statement of apply binds per acknowledgement: a retry UPDATE binds an id and
+// a value for each of its four CASE expressions, plus the id in its WHERE clause. The lease lookup binds four and an
+// attempts insert seven.
+const bulkRowParams = 9
+
+// bulkChunk is how many acks one round of apply's statements covers. Besides keeping every statement under
+// maxBindParams, it bounds the CASE expressions and lease tuple lists, which are scanned for every updated row, so a
+// statement's cost would otherwise grow with the square of the batch.
+const bulkChunk = min(maxBindParams/bulkRowParams, 500)
+
+// apply locks the rows still held by the acks' leases, updates them with a single UPDATE whose SET clause comes
+// from set, then runs the follow-up statements for those rows, all in one transaction. Acks are processed in chunks
+// so no statement binds more than maxBindParams values. It returns the leases that no longer held their row; those
+// are left untouched.
+func (b bulkAcks) apply(
+	ctx context.Context,
+	acks []txoutbox.Ack,
+	set func(s *bulkSet) string,
+	followups func(held []txoutbox.Ack) []statement,
+) ([]txoutbox.Lease, error) {
+	if len(acks) == 0 {
+		return nil, nil
+	}
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var lost []txoutbox.Lease
+	for start := 0; start < len(acks); start += bulkChunk {
+		chunkLost, err := b.applyChunk(ctx, tx, acks[start:min(start+bulkChunk, len(acks))], set, followups)
+		if err != nil {
+			return nil, err
+		}
+		lost = append(lost, chunkLost...)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return lost, nil
+}
+
+// applyChunk runs apply's statements for acks inside tx.
+func (b bulkAcks) applyChunk(
+	ctx context.Context,
+	tx *sql.Tx,
+	acks []txoutbox.Ack,
+	set func(s *bulkSet) string,
+	followups func(held []txoutbox.Ack) []statement,
+) ([]txoutbox.Lease, error) {
+	leases := make([]txoutbox.Lease, len(acks))
+	candidates := make([]int64, len(acks))
+	for i, ack := range acks {
+		leases[i] = ack.Lease
+		candidates[i] = ack.Lease.ID
+	}
+
+	// The id condition lets every dialect use the primary key before checking the lease tuples.
+	byID, args := b.inIDs(candidates, nil)
+	match, args := leaseMatch(leases, args, b.placeholder)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE %s AND %s%s", b.table, byID, match, b.lock), args...)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[int64]bool, len(acks))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		held[id] = true
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		kept []txoutbox.Ack
+		ids  []int64
+		lost []txoutbox.Lease
+	)
+	for _, ack := range acks {
+		if held[ack.Lease.ID] {
+			kept = append(kept, ack)
+			ids = append(ids, ack.Lease.ID)
+		} else {
+			lost = append(lost, ack.Lease)
+		}
+	}
+	if len(kept) == 0 {
+		return lost, nil
+	}
+
+	s := &bulkSet{acks: kept, b: b}
+	clause := set(s)
+	where, args := b.inIDs(ids, s.args)
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE %s", b.table, clause, where), args...); err != nil {
+		return nil, err
+	}
+	for _, stmt := range followups(kept) {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return nil, err
+		}
+	}
+	return lost, nil
+}
+
+// sendSet marks rows sent.
+func sendSet(s *bulkSet) string {
+	at := func(ack txoutbox.Ack) any { return ack.Attempt.At }
+	return fmt.Sprintf(
+		"status = 'sent', sent_at = %s, last_attempt_at = %s, last_error = NULL, claimed_by = NULL, claimed_at = NULL",
+		s.each("timestamptz", at), s.each("timestamptz", at),
+	)
+}
+
+// retrySet schedules rows for another attempt.
+func retrySet(s *bulkSet) string {
+	return fmt.Sprintf(
+		"status = 'retry', retry_count = %s, next_retry_at = %s, last_error = %s, last_attempt_at = %s, claimed_by = NULL, claimed_at = NULL",
+		s.each("int", func(ack txoutbox.Ack) any { return ack.Attempt.Number }),
+		s.each("timestamptz", func(ack txoutbox.Ack) any { return ack.NextRetry }),
+		s.each("text", func(ack txoutbox.Ack) any { return attemptError(ack.Attempt.Err) }),
+		s.each("timestamptz", func(ack txoutbox.Ack) any { return ack.Attempt.At }),
+	)
+}
+
+// failSet marks rows permanently failed.
+func failSet(s *bulkSet) string {
+	return fmt.Sprintf(
+		"status = 'failed', retry_count = %s, last_error = %s, last_attempt_at = %s, claimed_by = NULL, claimed_at = NULL",
+		s.each("int", func(ack txoutbox.Ack) any { return ack.Attempt.Number }),
+		s.each("text", func(ack txoutbox.Ack) any { return attemptError(ack.Attempt.Err) }),
+		s.each("timestamptz", func(ack txoutbox.Ack) any { return ack.Attempt.At }),
+	)
+}
+
+// bulkHistory returns a multi-row insert recording the attempts, or nothing when no attempts table is configured.
+func bulkHistory(attempts string, acks []txoutbox.Ack, status string, placeholder func(n int) string) []statement {
+	if attempts == "" {
+		return nil
+	}
+	var (
+		args   []any
+		tuples = make([]string, len(acks))
+	)
+	for i, ack := range acks {
+		values := historyValues(ack.Lease, ack.Attempt, status)
+		marks := make([]string, len(values))
+		for j, v := range values {
+			args = append(args, v)
+			marks[j] = placeholder(len(args))
+		}
+		tuples[i] = "(" + strings.Join(marks, ", ") + ")"
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", attempts, historyColumns, strings.Join(tuples, ", "))
+	return []statement{{query, args}}
+}
+
+// keepMarker is the cast hook for dialects that infer parameter types inside CASE.
+func keepMarker(marker, _ string) string {
+	return marker
+}
+
+// inList matches ids with an IN list of question-mark placeholders.
+func inList(ids []int64, args []any) (string, []any) {
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return "id IN (" + placeholders(len(ids)) + ")", args
+}
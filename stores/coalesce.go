@@ -0,0 +1,98 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mickamy/txoutbox"
+)
+
+// coalescing supersedes still-pending messages when a newer one with the same topic and key is added.
+type coalescing struct {
+	// topics lists the topics that coalesce; nil disables coalescing.
+	topics map[string]bool
+	// table is the quoted outbox table and keyColumn the dialect-quoted key column.
+	table     string
+	keyColumn string
+	// placeholder renders the bind marker for the n-th (1-based) argument.
+	placeholder func(n int) string
+	// lockedCount wraps a SELECT of supersedes over the rows matching where into a query returning their count and
+	// sum while locking them, so the UPDATE that follows supersedes exactly the rows that were counted.
+	lockedCount func(table, where string) string
+}
+
+// applies reports whether msg replaces earlier pending messages; messages without a key never coalesce.
+func (c coalescing) applies(msg txoutbox.Message) bool {
+	return msg.Key != "" && c.topics[msg.Topic]
+}
+
+// anyApplies reports whether some message in msgs coalesces.
+func (c coalescing) anyApplies(msgs []txoutbox.Message) bool {
+	for _, msg := range msgs {
+		if c.applies(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// supersede marks the pending or retry-scheduled messages older than the row id with msg's topic and key as
+// superseded, then records on that row how many messages it replaced, counting those the superseded rows had
+// themselves replaced. Claimed messages are left to finish their delivery.
+func (c coalescing) supersede(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message, id int64) error {
+	if !c.applies(msg) {
+		return nil
+	}
+	where := fmt.Sprintf(
+		"topic = %s AND %s = %s AND id < %s AND status IN ('pending','retry')",
+		c.placeholder(1), c.keyColumn, c.placeholder(2), c.placeholder(3),
+	)
+	var rows, nested int64
+	if err := exec.QueryRowContext(ctx, c.lockedCount(c.table, where), msg.Topic, msg.Key, id).Scan(&rows, &nested); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return nil
+	}
+	query := fmt.Sprintf("UPDATE %s SET status = 'superseded' WHERE %s", c.table, where)
+	if _, err := exec.ExecContext(ctx, query, msg.Topic, msg.Key, id); err != nil {
+		return err
+	}
+	query = fmt.Sprintf("UPDATE %s SET supersedes = %s WHERE id = %s", c.table, c.placeholder(1), c.placeholder(2))
+	_, err := exec.ExecContext(ctx, query, rows+nested, id)
+	return err
+}
+
+// addEach enqueues msgs one at a time through add so every coalescing message supersedes its predecessors,
+// including earlier ones in the same batch; duplicates are skipped as AddMany does.
+func addEach(
+	ctx context.Context,
+	exec txoutbox.Executor,
+	msgs []txoutbox.Message,
+	add func(context.Context, txoutbox.Executor, txoutbox.Message) (int64, error),
+) error {
+	for _, msg := range msgs {
+		if _, err := add(ctx, exec, msg); err != nil && !errors.Is(err, txoutbox.ErrDuplicate) {
+			return err
+		}
+	}
+	return nil
+}
+
+// countSupersedes counts the rows matching where and sums what they had superseded, without locking them.
+func countSupersedes(table, where string) string {
+	return fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(supersedes), 0) FROM %s WHERE %s", table, where)
+}
+
+// topicSet turns a topic list into the lookup coalescing uses.
+func topicSet(topics []string) map[string]bool {
+	if len(topics) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		set[topic] = true
+	}
+	return set
+}
@@ -0,0 +1,176 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mickamy/txoutbox"
+	"github.com/mickamy/txoutbox/internal/sqlutil"
+)
+
+// deadLetters implements the txoutbox.DeadLetters queries shared by every store; only the dialect hooks differ.
+type deadLetters struct {
+	db        *sql.DB
+	table     string // already quoted
+	keyColumn string // already quoted
+	// attempts is the quoted attempts table, or empty when attempt history is not recorded.
+	attempts string
+	now      func() time.Time
+	// placeholder renders the bind marker for the n-th (1-based) argument.
+	placeholder func(n int) string
+	// contains renders a substring test of last_error against the given bind marker.
+	contains func(marker string) string
+}
+
+// where builds the condition selecting failed rows that match filter, appending its arguments to args.
+func (d deadLetters) where(filter txoutbox.DeadLetterFilter, args []any) (string, []any) {
+	bind := func(v any) string {
+		args = append(args, v)
+		return d.placeholder(len(args))
+	}
+	conds := []string{"status = 'failed'"}
+	if len(filter.IDs) > 0 {
+		marks := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			marks[i] = bind(id)
+		}
+		conds = append(conds, "id IN ("+strings.Join(marks, ", ")+")")
+	}
+	if filter.Topic != "" {
+		conds = append(conds, "topic = "+bind(filter.Topic))
+	}
+	if filter.Key != "" {
+		conds = append(conds, d.keyColumn+" = "+bind(filter.Key))
+	}
+	if !filter.FailedAfter.IsZero() {
+		conds = append(conds, "last_attempt_at >= "+bind(filter.FailedAfter.UTC()))
+	}
+	if !filter.FailedBefore.IsZero() {
+		conds = append(conds, "last_attempt_at < "+bind(filter.FailedBefore.UTC()))
+	}
+	if filter.ErrorContains != "" {
+		conds = append(conds, d.contains(bind(filter.ErrorContains)))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (d deadLetters) list(ctx context.Context, filter txoutbox.DeadLetterFilter, page txoutbox.Page) ([]txoutbox.DeadLetter, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = txoutbox.DefaultPageLimit
+	}
+	where, args := d.where(filter, nil)
+	args = append(args, page.AfterID)
+	after := d.placeholder(len(args))
+	args = append(args, limit)
+	query := fmt.Sprintf(
+		"SELECT id, topic, %s, payload, retry_count, created_at, headers, traceparent, tracestate, last_error, last_attempt_at FROM %s WHERE %s AND id > %s ORDER BY id LIMIT %s",
+		d.keyColumn, d.table, where, after, d.placeholder(len(args)),
+	)
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) { _ = rows.Close() }(rows)
+
+	var letters []txoutbox.DeadLetter
+	for rows.Next() {
+		var (
+			letter      txoutbox.DeadLetter
+			key         sql.NullString
+			payload     []byte
+			rawHeaders  []byte
+			traceParent sql.NullString
+			traceState  sql.NullString
+			lastError   sql.NullString
+			failedAt    sql.NullTime
+		)
+		if err := rows.Scan(&letter.ID, &letter.Topic, &key, &payload, &letter.RetryCount, &letter.CreatedAt, &rawHeaders, &traceParent, &traceState, &lastError, &failedAt); err != nil {
+			return nil, err
+		}
+		headers, err := decodeHeaders(rawHeaders)
+		if err != nil {
+			return nil, err
+		}
+		letter.Key = sqlutil.NullableString(key)
+		letter.Payload = bytes.Clone(payload)
+		letter.Headers = headers
+		letter.Trace = txoutbox.TraceContext{TraceParent: traceParent.String, TraceState: traceState.String}
+		letter.LastError = lastError.String
+		letter.FailedAt = failedAt.Time
+		letters = append(letters, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+func (d deadLetters) get(ctx context.Context, id int64) (txoutbox.DeadLetter, error) {
+	letters, err := d.list(ctx, txoutbox.DeadLetterFilter{IDs: []int64{id}}, txoutbox.Page{Limit: 1})
+	if err != nil {
+		return txoutbox.DeadLetter{}, err
+	}
+	if len(letters) == 0 {
+		return txoutbox.DeadLetter{}, fmt.Errorf("%w: id=%d", txoutbox.ErrNotFound, id)
+	}
+	return letters[0], nil
+}
+
+func (d deadLetters) requeue(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	if filter.IsEmpty() && !filter.All {
+		return 0, txoutbox.ErrEmptyFilter
+	}
+	args := []any{d.now().UTC()}
+	where, args := d.where(filter, args)
+	query := fmt.Sprintf(
+		"UPDATE %s SET status = 'pending', retry_count = 0, next_retry_at = %s, claimed_by = NULL, claimed_at = NULL WHERE %s",
+		d.table, d.placeholder(1), where,
+	)
+	res, err := d.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// discard deletes the matching rows and, when attempt history is recorded, their attempts in the same transaction.
+func (d deadLetters) discard(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	if filter.IsEmpty() && !filter.All {
+		return 0, txoutbox.ErrEmptyFilter
+	}
+	where, args := d.where(filter, nil)
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if d.attempts != "" {
+		query := fmt.Sprintf("DELETE FROM %s WHERE message_id IN (SELECT id FROM %s WHERE %s)", d.attempts, d.table, where)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", d.table, where), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// questionMark is the placeholder style shared by MySQL and SQLite.
+func questionMark(int) string {
+	return "?"
+}
@@ -0,0 +1,86 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mickamy/txoutbox"
+)
+
+// dedupColumn holds Message.DedupKey; a unique index on it rejects duplicates while NULLs stay distinct.
+const dedupColumn = "dedup_key"
+
+// dedupSkip is the clause a dialect appends to an INSERT's VALUES list so rows whose dedup key is already taken are
+// skipped without raising an error that would abort the caller's transaction. Only dedup key conflicts are skipped;
+// other errors (e.g. a value too long for its column) still surface, which rules out INSERT IGNORE and INSERT OR
+// IGNORE. MySQL cannot name the conflicting index (ON DUPLICATE KEY UPDATE fires for every unique key), so it looks
+// taken keys up before a plain INSERT instead and uses no clause.
+type dedupSkip string
+
+const (
+	postgresDedup dedupSkip = " ON CONFLICT (" + dedupColumn + ") DO NOTHING"
+	sqliteDedup             = postgresDedup
+)
+
+// suffix returns the clause to append for a row with the given columns; rows without a dedup key get none.
+func (d dedupSkip) suffix(columns []string) string {
+	if !slices.Contains(columns, dedupColumn) {
+		return ""
+	}
+	return string(d)
+}
+
+// skipDuplicates returns msgs without the messages whose dedup key is in taken or repeats an earlier message's key,
+// keeping the first of each; taken gains every key kept.
+func skipDuplicates(msgs []txoutbox.Message, taken map[string]bool) []txoutbox.Message {
+	fresh := make([]txoutbox.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.DedupKey != "" {
+			if taken[msg.DedupKey] {
+				continue
+			}
+			taken[msg.DedupKey] = true
+		}
+		fresh = append(fresh, msg)
+	}
+	return fresh
+}
+
+// releaseDedupKeys clears the dedup key of rows among msgs' keys that were created before cutoff, so messages
+// enqueued outside the dedup window are not reported as duplicates. A zero cutoff keeps keys for the row's lifetime.
+func releaseDedupKeys(
+	ctx context.Context,
+	exec txoutbox.Executor,
+	table string,
+	msgs []txoutbox.Message,
+	cutoff time.Time,
+	placeholder func(n int) string,
+) error {
+	if cutoff.IsZero() {
+		return nil
+	}
+	var (
+		args  []any
+		marks []string
+	)
+	for _, msg := range msgs {
+		if msg.DedupKey == "" || slices.Contains(args, any(msg.DedupKey)) {
+			continue
+		}
+		args = append(args, msg.DedupKey)
+		marks = append(marks, placeholder(len(args)))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	args = append(args, cutoff)
+	query := fmt.Sprintf(
+		"UPDATE %s SET %s = NULL WHERE %s IN (%s) AND created_at < %s",
+		table, dedupColumn, dedupColumn, strings.Join(marks, ", "), placeholder(len(args)),
+	)
+	_, err := exec.ExecContext(ctx, query, args...)
+	return err
+}
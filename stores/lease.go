@@ -0,0 +1,53 @@
+package stores
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mickamy/txoutbox"
+)
+
+// checkLease maps an acknowledgement that matched no rows to txoutbox.ErrLeaseLost.
+func checkLease(res sql.Result, err error, lease txoutbox.Lease) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: id=%d worker=%s token=%d", txoutbox.ErrLeaseLost, lease.ID, lease.WorkerID, lease.Token)
+	}
+	return nil
+}
+
+// leaseMatch renders a condition matching rows still held by any of the leases, appending its arguments to args.
+func leaseMatch(leases []txoutbox.Lease, args []any, placeholder func(n int) string) (string, []any) {
+	tuples := make([]string, len(leases))
+	for i, lease := range leases {
+		args = append(args, lease.ID, lease.WorkerID, lease.Token)
+		n := len(args)
+		tuples[i] = "(" + placeholder(n-2) + ", " + placeholder(n-1) + ", " + placeholder(n) + ")"
+	}
+	return "(id, claimed_by, lease_token) IN (" + strings.Join(tuples, ", ") + ")", args
+}
+
+// releaseChunk caps how many leases one Release statement matches: leaseMatch binds three values per lease on top
+// of the retry time.
+const releaseChunk = (maxBindParams - 1) / 3
+
+// releaseInChunks calls release for consecutive runs of at most releaseChunk leases, summing the rows released.
+// Each run commits on its own; a failure leaves earlier runs released, which is harmless since Release is idempotent.
+func releaseInChunks(leases []txoutbox.Lease, release func([]txoutbox.Lease) (int64, error)) (int64, error) {
+	var released int64
+	for start := 0; start < len(leases); start += releaseChunk {
+		n, err := release(leases[start:min(start+releaseChunk, len(leases))])
+		released += n
+		if err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
@@ -3,6 +3,7 @@ package stores
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -12,9 +13,19 @@ import (
 )
 
 type MySQL struct {
-	db    *sql.DB
-	table string
-	now   func() time.Time
+	db          *sql.DB
+	table       string
+	now         func() time.Time
+	orderedKeys bool
+	propagator  txoutbox.Propagator
+	// attemptsTable optionally records every delivery attempt; empty disables the history.
+	attemptsTable string
+	// archiveTable receives sent rows in archive mode; empty keeps them in the outbox table.
+	archiveTable string
+	// dedupWindow bounds how long a DedupKey rejects duplicates; zero keeps it for the row's lifetime.
+	dedupWindow time.Duration
+	// coalescedTopics lists the topics whose messages supersede pending ones with the same key.
+	coalescedTopics map[string]bool
 }
 
 type MySQLOption func(*MySQL)
@@ -35,6 +46,53 @@ func WithMySQLNow(now func() time.Time) MySQLOption {
 	}
 }
 
+// WithMySQLOrderedKeys makes Claim skip a keyed message until every earlier message with the same key
+// is sent, failed or cancelled, so messages sharing a key are delivered one at a time in insertion order.
+func WithMySQLOrderedKeys(enabled bool) MySQLOption {
+	return func(s *MySQL) {
+		s.orderedKeys = enabled
+	}
+}
+
+// WithMySQLPropagator captures the caller's trace context in Add so the relay can restore it on delivery.
+func WithMySQLPropagator(p txoutbox.Propagator) MySQLOption {
+	return func(s *MySQL) {
+		s.propagator = p
+	}
+}
+
+// WithMySQLAttemptsTable records every delivery attempt (worker, time, duration, error) in the given table.
+func WithMySQLAttemptsTable(table string) MySQLOption {
+	return func(s *MySQL) {
+		s.attemptsTable = table
+	}
+}
+
+// WithMySQLArchiveTable turns on archive mode: Send moves each delivered row into the given table, keeping the
+// outbox table small for Claim while retaining sent events for audit. An archived row no longer holds its DedupKey.
+func WithMySQLArchiveTable(table string) MySQLOption {
+	return func(s *MySQL) {
+		s.archiveTable = table
+	}
+}
+
+// WithMySQLDedupWindow limits deduplication to messages enqueued within d: Add first clears the DedupKey of older
+// rows so the key can be reused. Zero (the default) rejects a key for as long as a row holding it exists.
+func WithMySQLDedupWindow(d time.Duration) MySQLOption {
+	return func(s *MySQL) {
+		s.dedupWindow = d
+	}
+}
+
+// WithMySQLCoalescedTopics makes messages on the given topics latest-wins: Add marks every still-pending message
+// with the same topic and key as 'superseded', so the relay only ships the newest state. Messages already claimed
+// are still delivered, and messages without a key never coalesce.
+func WithMySQLCoalescedTopics(topics ...string) MySQLOption {
+	return func(s *MySQL) {
+		s.coalescedTopics = topicSet(topics)
+	}
+}
+
 func NewMySQL(db *sql.DB, opts ...MySQLOption) *MySQL {
 	store := &MySQL{
 		db:    db,
@@ -47,18 +105,142 @@ func NewMySQL(db *sql.DB, opts ...MySQLOption) *MySQL {
 	return store
 }
 
-func (s *MySQL) Add(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message) error {
-	payload, err := msg.MarshalPayload()
+// Add inserts a new message row within the caller's transaction and returns its ID via LastInsertId.
+// A message with a DedupKey first locks any row holding that key and reports txoutbox.ErrDuplicate when one exists.
+// Two transactions enqueueing the same new key at the same moment can still see a duplicate-key or deadlock error
+// from the second INSERT.
+func (s *MySQL) Add(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message) (int64, error) {
+	columns, values, err := insertRow(msg, "`key`", injectTrace(ctx, s.propagator))
+	if err != nil {
+		return 0, err
+	}
+	if err := releaseDedupKeys(ctx, exec, s.tableIdent(), []txoutbox.Message{msg}, s.dedupCutoff(), questionMark); err != nil {
+		return 0, err
+	}
+	if msg.DedupKey != "" {
+		taken, err := s.takenDedupKeys(ctx, exec, []txoutbox.Message{msg})
+		if err != nil {
+			return 0, err
+		}
+		if len(taken) > 0 {
+			return 0, txoutbox.ErrDuplicate
+		}
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.tableIdent(), strings.Join(columns, ", "), placeholders(len(values)))
+	res, err := exec.ExecContext(ctx, query, values...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := s.coalescing().supersede(ctx, exec, msg, id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// coalescing returns the latest-wins settings for Add.
+func (s *MySQL) coalescing() coalescing {
+	return coalescing{
+		topics:      s.coalescedTopics,
+		table:       s.tableIdent(),
+		keyColumn:   "`key`",
+		placeholder: questionMark,
+		lockedCount: func(table, where string) string { return countSupersedes(table, where) + " FOR UPDATE" },
+	}
+}
+
+// takenDedupKeys returns which of msgs' dedup keys already belong to a row, locking those rows until the caller's
+// transaction ends. Executor only reads single rows, so each chunk of keys comes back as one JSON array.
+func (s *MySQL) takenDedupKeys(ctx context.Context, exec txoutbox.Executor, msgs []txoutbox.Message) (map[string]bool, error) {
+	var keys []any
+	seen := make(map[string]bool)
+	for _, msg := range msgs {
+		if msg.DedupKey != "" && !seen[msg.DedupKey] {
+			seen[msg.DedupKey] = true
+			keys = append(keys, msg.DedupKey)
+		}
+	}
+	taken := make(map[string]bool)
+	for start := 0; start < len(keys); start += maxBindParams {
+		chunk := keys[start:min(start+maxBindParams, len(keys))]
+		query := fmt.Sprintf(
+			"SELECT JSON_ARRAYAGG(%s) FROM %s WHERE %s IN (%s) FOR UPDATE",
+			dedupColumn, s.tableIdent(), dedupColumn, placeholders(len(chunk)),
+		)
+		var raw []byte
+		if err := exec.QueryRowContext(ctx, query, chunk...).Scan(&raw); err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		var found []string
+		if err := json.Unmarshal(raw, &found); err != nil {
+			return nil, fmt.Errorf("txoutbox: decode dedup keys: %w", err)
+		}
+		for _, key := range found {
+			taken[key] = true
+		}
+	}
+	return taken, nil
+}
+
+// dedupCutoff returns the creation time before which dedup keys no longer count, or zero without a window.
+func (s *MySQL) dedupCutoff() time.Time {
+	if s.dedupWindow <= 0 {
+		return time.Time{}
+	}
+	return s.now().UTC().Add(-s.dedupWindow)
+}
+
+// AddMany enqueues msgs in order with multi-row INSERTs, validating every message before writing any. Batches
+// touching coalesced topics are added one message at a time so each supersedes its predecessors.
+func (s *MySQL) AddMany(ctx context.Context, exec txoutbox.Executor, msgs []txoutbox.Message) error {
+	trace := injectTrace(ctx, s.propagator)
+	runs, err := insertRuns(msgs, "`key`", trace)
 	if err != nil {
 		return err
 	}
-	query := fmt.Sprintf("INSERT INTO %s (topic, `key`, payload) VALUES (?, ?, ?)", s.tableIdent())
-	var key any
-	if msg.Key != "" {
-		key = msg.Key
+	if s.coalescing().anyApplies(msgs) {
+		return addEach(ctx, exec, msgs, s.Add)
 	}
-	_, err = exec.ExecContext(ctx, query, msg.Topic, key, payload)
-	return err
+	if err := releaseDedupKeys(ctx, exec, s.tableIdent(), msgs, s.dedupCutoff(), questionMark); err != nil {
+		return err
+	}
+	taken, err := s.takenDedupKeys(ctx, exec, msgs)
+	if err != nil {
+		return err
+	}
+	if fresh := skipDuplicates(msgs, taken); len(fresh) < len(msgs) {
+		if runs, err = insertRuns(fresh, "`key`", trace); err != nil {
+			return err
+		}
+	}
+	return insertMany(ctx, exec, s.tableIdent(), runs, questionMark, "")
+}
+
+// Cancel withdraws a message that has not been claimed for delivery yet.
+func (s *MySQL) Cancel(ctx context.Context, exec txoutbox.Executor, id int64) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET status='cancelled' WHERE id=? AND status IN ('pending','retry')", s.tableIdent())
+	res, err := exec.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CancelByKey withdraws every unclaimed message with the given key.
+func (s *MySQL) CancelByKey(ctx context.Context, exec txoutbox.Executor, key string) (int64, error) {
+	query := fmt.Sprintf("UPDATE %s SET status='cancelled' WHERE `key`=? AND status IN ('pending','retry')", s.tableIdent())
+	res, err := exec.ExecContext(ctx, query, key)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
 func (s *MySQL) Claim(ctx context.Context, workerID string, limit int, leaseTTL time.Duration) ([]txoutbox.Envelope, error) {
@@ -100,12 +282,12 @@ func (s *MySQL) Claim(ctx context.Context, workerID string, limit int, leaseTTL
 
 func (s *MySQL) selectCandidateIDs(ctx context.Context, tx *sql.Tx, limit int) ([]int64, error) {
 	query := fmt.Sprintf(`
-SELECT id FROM %s
+SELECT id FROM %s AS c
 WHERE status IN ('pending','retry','sending')
-  AND next_retry_at <= NOW(6)
+  AND next_retry_at <= NOW(6)%s
 ORDER BY id
 LIMIT %d
-FOR UPDATE SKIP LOCKED`, s.tableIdent(), limit)
+FOR UPDATE SKIP LOCKED`, s.tableIdent(), s.orderedKeysFilter(), limit)
 	rows, err := tx.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
@@ -125,13 +307,28 @@ FOR UPDATE SKIP LOCKED`, s.tableIdent(), limit)
 	return ids, rows.Err()
 }
 
+// orderedKeysFilter restricts Claim candidates to the oldest unfinished message per key.
+func (s *MySQL) orderedKeysFilter() string {
+	if !s.orderedKeys {
+		return ""
+	}
+	return fmt.Sprintf(`
+  AND (c.`+"`key`"+` IS NULL OR NOT EXISTS (
+      SELECT 1 FROM %s AS p
+      WHERE p.`+"`key`"+` = c.`+"`key`"+`
+        AND p.id < c.id
+        AND p.status NOT IN ('sent','failed','cancelled','superseded')
+  ))`, s.tableIdent())
+}
+
 func (s *MySQL) markSending(ctx context.Context, tx *sql.Tx, ids []int64, workerID string, claimedAt, leaseUntil time.Time) error {
 	query := fmt.Sprintf(`
 UPDATE %s
 SET status = 'sending',
     claimed_by = ?,
     claimed_at = ?,
-    next_retry_at = ?
+    next_retry_at = ?,
+    lease_token = lease_token + 1
 WHERE id IN (%s)`, s.tableIdent(), placeholders(len(ids)))
 	args := []any{workerID, claimedAt, leaseUntil}
 	for _, id := range ids {
@@ -143,7 +340,7 @@ WHERE id IN (%s)`, s.tableIdent(), placeholders(len(ids)))
 
 func (s *MySQL) fetchEnvelopes(ctx context.Context, tx *sql.Tx, ids []int64) ([]txoutbox.Envelope, error) {
 	query := fmt.Sprintf(`
-SELECT id, topic, `+"`key`"+`, payload, retry_count, created_at
+SELECT id, topic, `+"`key`"+`, payload, retry_count, created_at, claimed_by, lease_token, headers, traceparent, tracestate, supersedes
 FROM %s
 WHERE id IN (%s)`, s.tableIdent(), placeholders(len(ids)))
 
@@ -161,14 +358,24 @@ WHERE id IN (%s)`, s.tableIdent(), placeholders(len(ids)))
 	var envelopes []txoutbox.Envelope
 	for rows.Next() {
 		var (
-			id         int64
-			topic      string
-			key        sql.NullString
-			payload    []byte
-			retryCount int
-			createdAt  time.Time
+			id          int64
+			topic       string
+			key         sql.NullString
+			payload     []byte
+			retryCount  int
+			createdAt   time.Time
+			claimedBy   string
+			leaseToken  int64
+			rawHeaders  []byte
+			traceParent sql.NullString
+			traceState  sql.NullString
+			supersedes  int
 		)
-		if err := rows.Scan(&id, &topic, &key, &payload, &retryCount, &createdAt); err != nil {
+		if err := rows.Scan(&id, &topic, &key, &payload, &retryCount, &createdAt, &claimedBy, &leaseToken, &rawHeaders, &traceParent, &traceState, &supersedes); err != nil {
+			return nil, err
+		}
+		headers, err := decodeHeaders(rawHeaders)
+		if err != nil {
 			return nil, err
 		}
 		var keyPtr *string
@@ -183,53 +390,246 @@ WHERE id IN (%s)`, s.tableIdent(), placeholders(len(ids)))
 			Payload:    append([]byte(nil), payload...),
 			RetryCount: retryCount,
 			CreatedAt:  createdAt,
+			ClaimedBy:  claimedBy,
+			LeaseToken: leaseToken,
+			Headers:    headers,
+			Trace:      txoutbox.TraceContext{TraceParent: traceParent.String, TraceState: traceState.String},
+			Supersedes: supersedes,
 		})
 	}
 	return envelopes, rows.Err()
 }
 
-func (s *MySQL) Send(ctx context.Context, id int64, sendAt time.Time) error {
-	query := fmt.Sprintf("UPDATE %s SET status='sent', sent_at=?, claimed_by=NULL, claimed_at=NULL WHERE id=?", s.tableIdent())
-	_, err := s.db.ExecContext(ctx, query, sendAt, id)
-	return err
+func (s *MySQL) Send(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
+	query := fmt.Sprintf(`
+UPDATE %s
+SET status='sent',
+    sent_at=?,
+    last_attempt_at=?,
+    last_error=NULL,
+    claimed_by=NULL,
+    claimed_at=NULL
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	args := []any{attempt.At, attempt.At, lease.ID, lease.WorkerID, lease.Token}
+	followups := append(s.attemptHistory(lease, attempt, "sent"), s.archive().move(lease)...)
+	return acknowledge(ctx, s.db, lease, statement{query, args}, followups...)
 }
 
-func (s *MySQL) Retry(ctx context.Context, id int64, retryCount int, nextRetry time.Time) error {
+func (s *MySQL) Retry(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt, nextRetry time.Time) error {
 	query := fmt.Sprintf(`
 UPDATE %s
 SET status='retry',
     retry_count=?,
     next_retry_at=?,
+    last_error=?,
+    last_attempt_at=?,
     claimed_by=NULL,
     claimed_at=NULL
-WHERE id=?`, s.tableIdent())
-	_, err := s.db.ExecContext(ctx, query, retryCount, nextRetry, id)
-	return err
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	args := []any{attempt.Number, nextRetry, attemptError(attempt.Err), attempt.At, lease.ID, lease.WorkerID, lease.Token}
+	return acknowledge(ctx, s.db, lease, statement{query, args}, s.attemptHistory(lease, attempt, "retry")...)
 }
 
-func (s *MySQL) Fail(ctx context.Context, id int64, retryCount int) error {
+func (s *MySQL) Fail(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
 	query := fmt.Sprintf(`
 UPDATE %s
 SET status='failed',
     retry_count=?,
+    last_error=?,
+    last_attempt_at=?,
     claimed_by=NULL,
     claimed_at=NULL
-WHERE id=?`, s.tableIdent())
-	_, err := s.db.ExecContext(ctx, query, retryCount, id)
-	return err
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	args := []any{attempt.Number, attemptError(attempt.Err), attempt.At, lease.ID, lease.WorkerID, lease.Token}
+	return acknowledge(ctx, s.db, lease, statement{query, args}, s.attemptHistory(lease, attempt, "failed")...)
 }
 
-func (s *MySQL) tableIdent() string {
-	return sqlutil.QuoteIdentifier(s.table, "`")
+// ExtendLease pushes the lease expiry to ttl from now if the row is still held by the lease.
+// MySQL does not count rows whose values did not change, so a second extension within the same second is
+// confirmed with a lookup before reporting the lease as lost.
+func (s *MySQL) ExtendLease(ctx context.Context, lease txoutbox.Lease, ttl time.Duration) error {
+	query := fmt.Sprintf(`
+UPDATE %s
+SET next_retry_at=?
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	res, err := s.db.ExecContext(ctx, query, s.now().UTC().Add(ttl), lease.ID, lease.WorkerID, lease.Token)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	var held int
+	err = s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id=? AND claimed_by=? AND lease_token=?", s.tableIdent()),
+		lease.ID, lease.WorkerID, lease.Token).Scan(&held)
+	if err != nil {
+		return err
+	}
+	if held == 0 {
+		return fmt.Errorf("%w: id=%d worker=%s token=%d", txoutbox.ErrLeaseLost, lease.ID, lease.WorkerID, lease.Token)
+	}
+	return nil
+}
+
+// Release hands claimed rows back without counting an attempt, making them claimable again at once.
+// Large batches are split so no statement binds more than maxBindParams values.
+func (s *MySQL) Release(ctx context.Context, leases []txoutbox.Lease) (int64, error) {
+	return releaseInChunks(leases, func(chunk []txoutbox.Lease) (int64, error) {
+		return s.release(ctx, chunk)
+	})
+}
+
+func (s *MySQL) release(ctx context.Context, leases []txoutbox.Lease) (int64, error) {
+	match, args := leaseMatch(leases, []any{s.now().UTC()}, questionMark)
+	query := fmt.Sprintf(`
+UPDATE %s
+SET status = CASE WHEN retry_count > 0 THEN 'retry' ELSE 'pending' END,
+    next_retry_at = ?,
+    claimed_by = NULL,
+    claimed_at = NULL
+WHERE %s`, s.tableIdent(), match)
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SendMany marks every message still held by its lease as sent in one transaction, returning the leases that were
+// lost.
+func (s *MySQL) SendMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, sendSet, func(held []txoutbox.Ack) []statement {
+		return append(bulkHistory(s.attemptsIdent(), held, "sent", questionMark), s.archive().moveMany(held)...)
+	})
+}
+
+// RetryMany schedules every message still held by its lease for another attempt in one transaction, returning the
+// leases that were lost.
+func (s *MySQL) RetryMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, retrySet, func(held []txoutbox.Ack) []statement {
+		return bulkHistory(s.attemptsIdent(), held, "retry", questionMark)
+	})
+}
+
+// FailMany marks every message still held by its lease permanently failed in one transaction, returning the leases
+// that were lost.
+func (s *MySQL) FailMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, failSet, func(held []txoutbox.Ack) []statement {
+		return bulkHistory(s.attemptsIdent(), held, "failed", questionMark)
+	})
+}
+
+func (s *MySQL) bulk() bulkAcks {
+	return bulkAcks{
+		db:          s.db,
+		table:       s.tableIdent(),
+		placeholder: questionMark,
+		cast:        keepMarker,
+		lock:        " FOR UPDATE",
+		inIDs:       inList,
+	}
 }
 
-func placeholders(n int) string {
-	if n <= 0 {
+// attemptsIdent returns the quoted attempts table, or an empty string when attempt history is off.
+func (s *MySQL) attemptsIdent() string {
+	if s.attemptsTable == "" {
 		return ""
 	}
-	parts := make([]string, n)
-	for i := range parts {
-		parts[i] = "?"
+	return sqlutil.QuoteIdentifier(s.attemptsTable, "`")
+}
+
+// attemptHistory returns the insert recording an attempt, or nothing when no attempts table is configured.
+func (s *MySQL) attemptHistory(lease txoutbox.Lease, attempt txoutbox.Attempt, status string) []statement {
+	if s.attemptsTable == "" {
+		return nil
 	}
-	return strings.Join(parts, ",")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sqlutil.QuoteIdentifier(s.attemptsTable, "`"), historyColumns, placeholders(7))
+	return []statement{{query, historyValues(lease, attempt, status)}}
+}
+
+// ListFailed returns permanently failed messages matching filter, ordered by ID.
+func (s *MySQL) ListFailed(ctx context.Context, filter txoutbox.DeadLetterFilter, page txoutbox.Page) ([]txoutbox.DeadLetter, error) {
+	return s.deadLetters().list(ctx, filter, page)
+}
+
+// GetFailed returns a single permanently failed message, or txoutbox.ErrNotFound.
+func (s *MySQL) GetFailed(ctx context.Context, id int64) (txoutbox.DeadLetter, error) {
+	return s.deadLetters().get(ctx, id)
+}
+
+// RequeueFailed makes matching failed messages claimable again with retry_count reset to zero.
+func (s *MySQL) RequeueFailed(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	return s.deadLetters().requeue(ctx, filter)
+}
+
+// DiscardFailed deletes matching failed messages along with their attempt history.
+func (s *MySQL) DiscardFailed(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	return s.deadLetters().discard(ctx, filter)
+}
+
+func (s *MySQL) deadLetters() deadLetters {
+	return deadLetters{
+		db:          s.db,
+		table:       s.tableIdent(),
+		keyColumn:   "`key`",
+		attempts:    s.attemptsIdent(),
+		now:         s.now,
+		placeholder: questionMark,
+		contains:    func(marker string) string { return "LOCATE(" + marker + ", last_error) > 0" },
+	}
+}
+
+// PurgeSent deletes up to limit sent messages delivered before the cutoff, along with their attempt history.
+func (s *MySQL) PurgeSent(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.purge(ctx, s.tableIdent(), "status = 'sent' AND sent_at < ?", before, limit)
+}
+
+// PurgeFailed deletes up to limit failed messages whose final attempt happened before the cutoff.
+// Rows failed before last_attempt_at was tracked fall back to created_at.
+func (s *MySQL) PurgeFailed(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.purge(ctx, s.tableIdent(), "status = 'failed' AND COALESCE(last_attempt_at, created_at) < ?", before, limit)
+}
+
+func (s *MySQL) purge(ctx context.Context, table, cond string, before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, fmt.Errorf("txoutbox: batch size must be positive")
+	}
+	var attempts string
+	if s.attemptsTable != "" {
+		attempts = sqlutil.QuoteIdentifier(s.attemptsTable, "`")
+	}
+	query := fmt.Sprintf("SELECT id FROM %s WHERE %s ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED", table, cond)
+	return purgeRows(ctx, s.db, table, attempts, query, []any{before.UTC(), limit}, placeholders)
+}
+
+// ListArchived returns messages moved to the archive table, ordered by ID.
+func (s *MySQL) ListArchived(ctx context.Context, filter txoutbox.ArchiveFilter, page txoutbox.Page) ([]txoutbox.ArchivedMessage, error) {
+	return s.archive().list(ctx, filter, page)
+}
+
+// PurgeArchived deletes up to limit archived messages delivered before the cutoff, along with their attempt history.
+func (s *MySQL) PurgeArchived(ctx context.Context, before time.Time, limit int) (int64, error) {
+	table := s.archive().table
+	if table == "" {
+		return 0, txoutbox.ErrNoArchive
+	}
+	return s.purge(ctx, table, "sent_at < ?", before, limit)
+}
+
+func (s *MySQL) archive() archive {
+	var table string
+	if s.archiveTable != "" {
+		table = sqlutil.QuoteIdentifier(s.archiveTable, "`")
+	}
+	return archive{
+		db:          s.db,
+		table:       table,
+		source:      s.tableIdent(),
+		keyColumn:   "`key`",
+		placeholder: questionMark,
+	}
+}
+
+func (s *MySQL) tableIdent() string {
+	return sqlutil.QuoteIdentifier(s.table, "`")
 }
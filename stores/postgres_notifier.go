@@ -0,0 +1,134 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/mickamy/txoutbox"
+	"github.com/mickamy/txoutbox/internal/sqlutil"
+)
+
+// PostgresNotifier wakes a Relay when a Postgres store built with WithPostgresNotify commits a message.
+// It LISTENs on a dedicated connection taken from db, which must use the pgx driver, and reconnects after
+// failures; the relay keeps polling in the meantime.
+type PostgresNotifier struct {
+	db             *sql.DB
+	channel        string
+	reconnectDelay time.Duration
+	// logger reports lost connections and failed reconnects; nil discards them.
+	logger txoutbox.Logger
+}
+
+type PostgresNotifierOption func(*PostgresNotifier)
+
+// WithPostgresNotifierReconnectDelay sets how long the notifier waits before listening again after a failure.
+func WithPostgresNotifierReconnectDelay(d time.Duration) PostgresNotifierOption {
+	return func(n *PostgresNotifier) {
+		if d > 0 {
+			n.reconnectDelay = d
+		}
+	}
+}
+
+// WithPostgresNotifierLogger reports lost connections and failed reconnects, which otherwise only show up as
+// missing wake-ups. Pass the relay's Options.Logger to keep them next to the relay's own logs.
+func WithPostgresNotifierLogger(logger txoutbox.Logger) PostgresNotifierOption {
+	return func(n *PostgresNotifier) {
+		n.logger = logger
+	}
+}
+
+// NewPostgresNotifier listens on channel, which must match the one passed to WithPostgresNotify.
+func NewPostgresNotifier(db *sql.DB, channel string, opts ...PostgresNotifierOption) *PostgresNotifier {
+	n := &PostgresNotifier{
+		db:             db,
+		channel:        channel,
+		reconnectDelay: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+// Listen subscribes on a dedicated connection, then keeps listening in the background and returns the wake-up
+// channel. It returns the error of the first subscription, e.g. when db does not use the pgx driver or the
+// database is unreachable; once subscribed, failures are logged and the notifier reconnects after the reconnect
+// delay until ctx is done.
+func (n *PostgresNotifier) Listen(ctx context.Context) (<-chan struct{}, error) {
+	if n.channel == "" {
+		return nil, fmt.Errorf("txoutbox: notify channel must not be empty")
+	}
+	wake := make(chan struct{}, 1)
+	subscribed := make(chan error, 1)
+	go func() {
+		defer close(wake)
+		first := true
+		for {
+			err := n.listen(ctx, wake, func() {
+				if first {
+					first = false
+					subscribed <- nil
+				}
+			})
+			if first {
+				subscribed <- err
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			n.logError(ctx, "postgres notifier on %q failed, reconnecting in %s: %v", n.channel, n.reconnectDelay, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(n.reconnectDelay):
+			}
+		}
+	}()
+	if err := <-subscribed; err != nil {
+		return nil, err
+	}
+	return wake, nil
+}
+
+// listen holds one connection in LISTEN mode until it fails or ctx is done, calling ready once the LISTEN succeeded.
+// The connection is always discarded afterwards so it never returns to the pool while still subscribed.
+func (n *PostgresNotifier) listen(ctx context.Context, wake chan<- struct{}, ready func()) error {
+	conn, err := n.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return conn.Raw(func(driverConn any) error {
+		pc, ok := driverConn.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return fmt.Errorf("txoutbox: postgres notifier requires the pgx driver, got %T", driverConn)
+		}
+		c := pc.Conn()
+		if _, err := c.Exec(ctx, "LISTEN "+sqlutil.QuoteIdentifier(n.channel, `"`)); err != nil {
+			return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+		}
+		ready()
+		// Messages committed while we were reconnecting produced no notification we could see.
+		txoutbox.WakeUp(wake)
+		for {
+			if _, err := c.WaitForNotification(ctx); err != nil {
+				return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+			}
+			txoutbox.WakeUp(wake)
+		}
+	})
+}
+
+func (n *PostgresNotifier) logError(ctx context.Context, format string, v ...any) {
+	if n.logger != nil {
+		n.logger.Error(ctx, format, v...)
+	}
+}
@@ -4,17 +4,35 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
 	"github.com/mickamy/txoutbox"
 	"github.com/mickamy/txoutbox/internal/sqlutil"
 )
 
 type Postgres struct {
-	db    *sql.DB
-	table string
-	now   func() time.Time
+	db          *sql.DB
+	table       string
+	now         func() time.Time
+	orderedKeys bool
+	propagator  txoutbox.Propagator
+	// attemptsTable optionally records every delivery attempt; empty disables the history.
+	attemptsTable string
+	// archiveTable receives sent rows in archive mode; empty keeps them in the outbox table.
+	archiveTable string
+	// dedupWindow bounds how long a DedupKey rejects duplicates; zero keeps it for the row's lifetime.
+	dedupWindow time.Duration
+	// coalescedTopics lists the topics whose messages supersede pending ones with the same key.
+	coalescedTopics map[string]bool
+	// notifyChannel receives a pg_notify from Add when set, waking a PostgresNotifier on commit.
+	notifyChannel string
 }
 
 type PostgresOption func(*Postgres)
@@ -35,6 +53,61 @@ func WithPostgresNow(now func() time.Time) PostgresOption {
 	}
 }
 
+// WithPostgresOrderedKeys makes Claim skip a keyed message until every earlier message with the same key
+// is sent, failed or cancelled, so messages sharing a key are delivered one at a time in insertion order.
+func WithPostgresOrderedKeys(enabled bool) PostgresOption {
+	return func(s *Postgres) {
+		s.orderedKeys = enabled
+	}
+}
+
+// WithPostgresPropagator captures the caller's trace context in Add so the relay can restore it on delivery.
+func WithPostgresPropagator(p txoutbox.Propagator) PostgresOption {
+	return func(s *Postgres) {
+		s.propagator = p
+	}
+}
+
+// WithPostgresAttemptsTable records every delivery attempt (worker, time, duration, error) in the given table.
+func WithPostgresAttemptsTable(table string) PostgresOption {
+	return func(s *Postgres) {
+		s.attemptsTable = table
+	}
+}
+
+// WithPostgresArchiveTable turns on archive mode: Send moves each delivered row into the given table, keeping the
+// outbox table small for Claim while retaining sent events for audit. An archived row no longer holds its DedupKey.
+func WithPostgresArchiveTable(table string) PostgresOption {
+	return func(s *Postgres) {
+		s.archiveTable = table
+	}
+}
+
+// WithPostgresDedupWindow limits deduplication to messages enqueued within d: Add first clears the DedupKey of older
+// rows so the key can be reused. Zero (the default) rejects a key for as long as a row holding it exists.
+func WithPostgresDedupWindow(d time.Duration) PostgresOption {
+	return func(s *Postgres) {
+		s.dedupWindow = d
+	}
+}
+
+// WithPostgresCoalescedTopics makes messages on the given topics latest-wins: Add marks every still-pending message
+// with the same topic and key as 'superseded', so the relay only ships the newest state. Messages already claimed
+// are still delivered, and messages without a key never coalesce.
+func WithPostgresCoalescedTopics(topics ...string) PostgresOption {
+	return func(s *Postgres) {
+		s.coalescedTopics = topicSet(topics)
+	}
+}
+
+// WithPostgresNotify makes Add issue pg_notify on channel inside the caller's transaction, so a Relay using
+// NewPostgresNotifier wakes as soon as the transaction commits.
+func WithPostgresNotify(channel string) PostgresOption {
+	return func(s *Postgres) {
+		s.notifyChannel = channel
+	}
+}
+
 func NewPostgres(db *sql.DB, opts ...PostgresOption) *Postgres {
 	store := &Postgres{
 		db:    db,
@@ -47,21 +120,145 @@ func NewPostgres(db *sql.DB, opts ...PostgresOption) *Postgres {
 	return store
 }
 
-func (s *Postgres) Add(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message) error {
-	payload, err := msg.MarshalPayload()
+// Add inserts a new message row within the caller's transaction and returns its ID.
+// A message with a DedupKey is written with ON CONFLICT DO NOTHING, so a duplicate reports txoutbox.ErrDuplicate
+// without aborting the transaction.
+func (s *Postgres) Add(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message) (int64, error) {
+	columns, values, err := insertRow(msg, "key", injectTrace(ctx, s.propagator))
+	if err != nil {
+		return 0, err
+	}
+	table := sqlutil.QuoteIdentifier(s.table, `"`)
+	if err := releaseDedupKeys(ctx, exec, table, []txoutbox.Message{msg}, s.dedupCutoff(), func(n int) string { return "$" + strconv.Itoa(n) }); err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)%s RETURNING id",
+		table, strings.Join(columns, ", "), numberedPlaceholders(1, len(values)), postgresDedup.suffix(columns),
+	)
+	var id int64
+	if err := exec.QueryRowContext(ctx, query, values...).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, txoutbox.ErrDuplicate
+		}
+		return 0, err
+	}
+	if err := s.coalescing().supersede(ctx, exec, msg, id); err != nil {
+		return 0, err
+	}
+	if s.notifyChannel != "" {
+		if _, err := exec.ExecContext(ctx, "SELECT pg_notify($1, $2)", s.notifyChannel, msg.Topic); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// pgxCopier is the CopyFrom method of *pgx.Conn and pgx.Tx. Executors that also provide it let AddMany stream rows
+// with COPY. CopyFrom must run inside the caller's transaction (e.g. forward it to the pgx.Tx behind the executor)
+// so the copied rows commit or roll back with the business writes; database/sql alone offers no such executor.
+type pgxCopier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// coalescing returns the latest-wins settings for Add.
+func (s *Postgres) coalescing() coalescing {
+	return coalescing{
+		topics:      s.coalescedTopics,
+		table:       sqlutil.QuoteIdentifier(s.table, `"`),
+		keyColumn:   `"key"`,
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		lockedCount: func(table, where string) string {
+			// PostgreSQL rejects FOR UPDATE next to aggregates, so the rows are locked in a subquery.
+			return fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(supersedes), 0) FROM (SELECT supersedes FROM %s WHERE %s FOR UPDATE) AS held", table, where)
+		},
+	}
+}
+
+// dedupCutoff returns the creation time before which dedup keys no longer count, or zero without a window.
+func (s *Postgres) dedupCutoff() time.Time {
+	if s.dedupWindow <= 0 {
+		return time.Time{}
+	}
+	return s.now().UTC().Add(-s.dedupWindow)
+}
+
+// AddMany enqueues msgs in order, validating every message before writing any. Rows are streamed with COPY when
+// exec provides pgx's CopyFrom (see pgxCopier), and written with multi-row INSERTs otherwise;
+// batches carrying dedup keys always use INSERT, since COPY cannot skip conflicting rows. Batches touching coalesced
+// topics are added one message at a time so each supersedes its predecessors.
+func (s *Postgres) AddMany(ctx context.Context, exec txoutbox.Executor, msgs []txoutbox.Message) error {
+	runs, err := insertRuns(msgs, "key", injectTrace(ctx, s.propagator))
+	if err != nil || len(runs) == 0 {
+		return err
+	}
+	if s.coalescing().anyApplies(msgs) {
+		return addEach(ctx, exec, msgs, s.Add)
+	}
+	table := sqlutil.QuoteIdentifier(s.table, `"`)
+	placeholder := func(n int) string { return "$" + strconv.Itoa(n) }
+	if err := releaseDedupKeys(ctx, exec, table, msgs, s.dedupCutoff(), placeholder); err != nil {
+		return err
+	}
+	copier, ok := exec.(pgxCopier)
+	if ok && !slices.ContainsFunc(runs, func(run insertRun) bool { return slices.Contains(run.columns, dedupColumn) }) {
+		err = s.copyFrom(ctx, copier, runs)
+	} else {
+		err = insertMany(ctx, exec, table, runs, placeholder, postgresDedup)
+	}
 	if err != nil {
 		return err
 	}
+	if s.notifyChannel == "" {
+		return nil
+	}
+	notified := make(map[string]bool)
+	for _, msg := range msgs {
+		if notified[msg.Topic] {
+			continue
+		}
+		notified[msg.Topic] = true
+		if _, err := exec.ExecContext(ctx, "SELECT pg_notify($1, $2)", s.notifyChannel, msg.Topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Postgres) copyFrom(ctx context.Context, copier pgxCopier, runs []insertRun) error {
+	for _, run := range runs {
+		if _, err := copier.CopyFrom(ctx, pgx.Identifier{s.table}, run.columns, pgx.CopyFromRows(run.rows)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cancel withdraws a message that has not been claimed for delivery yet.
+func (s *Postgres) Cancel(ctx context.Context, exec txoutbox.Executor, id int64) (bool, error) {
 	query := fmt.Sprintf(
-		"INSERT INTO %s (topic, key, payload) VALUES ($1, $2, $3)",
+		"UPDATE %s SET status = 'cancelled' WHERE id = $1 AND status IN ('pending','retry')",
 		sqlutil.QuoteIdentifier(s.table, `"`),
 	)
-	var key any
-	if msg.Key != "" {
-		key = msg.Key
+	res, err := exec.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
 	}
-	_, err = exec.ExecContext(ctx, query, msg.Topic, key, payload)
-	return err
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CancelByKey withdraws every unclaimed message with the given key.
+func (s *Postgres) CancelByKey(ctx context.Context, exec txoutbox.Executor, key string) (int64, error) {
+	query := fmt.Sprintf(
+		"UPDATE %s SET status = 'cancelled' WHERE key = $1 AND status IN ('pending','retry')",
+		sqlutil.QuoteIdentifier(s.table, `"`),
+	)
+	res, err := exec.ExecContext(ctx, query, key)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
 func (s *Postgres) Claim(ctx context.Context, workerID string, limit int, leaseTTL time.Duration) ([]txoutbox.Envelope, error) {
@@ -72,9 +269,9 @@ func (s *Postgres) Claim(ctx context.Context, workerID string, limit int, leaseT
 	leaseUntil := now.Add(leaseTTL)
 	query := fmt.Sprintf(`
 WITH candidates AS (
-    SELECT id FROM %s
+    SELECT id FROM %s AS c
     WHERE status IN ('pending','retry','sending')
-      AND next_retry_at <= $1
+      AND next_retry_at <= $1%s
     ORDER BY id
     LIMIT $2
     FOR UPDATE SKIP LOCKED
@@ -83,11 +280,12 @@ UPDATE %s AS o
 SET status = 'sending',
     claimed_by = $3,
     claimed_at = $1,
-    next_retry_at = $4
+    next_retry_at = $4,
+    lease_token = o.lease_token + 1
 FROM candidates
 WHERE o.id = candidates.id
-RETURNING o.id, o.topic, o.key, o.payload, o.retry_count, o.created_at;
-`, sqlutil.QuoteIdentifier(s.table, `"`), sqlutil.QuoteIdentifier(s.table, `"`))
+RETURNING o.id, o.topic, o.key, o.payload, o.retry_count, o.created_at, o.claimed_by, o.lease_token, o.headers, o.traceparent, o.tracestate, o.supersedes;
+`, sqlutil.QuoteIdentifier(s.table, `"`), s.orderedKeysFilter(), sqlutil.QuoteIdentifier(s.table, `"`))
 
 	rows, err := s.db.QueryContext(ctx, query, now, limit, workerID, leaseUntil)
 	if err != nil {
@@ -98,14 +296,24 @@ RETURNING o.id, o.topic, o.key, o.payload, o.retry_count, o.created_at;
 	var envelopes []txoutbox.Envelope
 	for rows.Next() {
 		var (
-			id         int64
-			topic      string
-			key        sql.NullString
-			payload    []byte
-			retryCount int
-			createdAt  time.Time
+			id          int64
+			topic       string
+			key         sql.NullString
+			payload     []byte
+			retryCount  int
+			createdAt   time.Time
+			claimedBy   string
+			leaseToken  int64
+			rawHeaders  []byte
+			traceParent sql.NullString
+			traceState  sql.NullString
+			supersedes  int
 		)
-		if err := rows.Scan(&id, &topic, &key, &payload, &retryCount, &createdAt); err != nil {
+		if err := rows.Scan(&id, &topic, &key, &payload, &retryCount, &createdAt, &claimedBy, &leaseToken, &rawHeaders, &traceParent, &traceState, &supersedes); err != nil {
+			return nil, err
+		}
+		headers, err := decodeHeaders(rawHeaders)
+		if err != nil {
 			return nil, err
 		}
 		envelopes = append(envelopes, txoutbox.Envelope{
@@ -115,6 +323,11 @@ RETURNING o.id, o.topic, o.key, o.payload, o.retry_count, o.created_at;
 			Payload:    bytes.Clone(payload),
 			RetryCount: retryCount,
 			CreatedAt:  createdAt,
+			ClaimedBy:  claimedBy,
+			LeaseToken: leaseToken,
+			Headers:    headers,
+			Trace:      txoutbox.TraceContext{TraceParent: traceParent.String, TraceState: traceState.String},
+			Supersedes: supersedes,
 		})
 	}
 	if err := rows.Err(); err != nil {
@@ -123,42 +336,264 @@ RETURNING o.id, o.topic, o.key, o.payload, o.retry_count, o.created_at;
 	return envelopes, nil
 }
 
-func (s *Postgres) Send(ctx context.Context, id int64, sendAt time.Time) error {
+// orderedKeysFilter restricts Claim candidates to the oldest unfinished message per key.
+func (s *Postgres) orderedKeysFilter() string {
+	if !s.orderedKeys {
+		return ""
+	}
+	return fmt.Sprintf(`
+      AND (c.key IS NULL OR NOT EXISTS (
+          SELECT 1 FROM %s AS p
+          WHERE p.key = c.key
+            AND p.id < c.id
+            AND p.status NOT IN ('sent','failed','cancelled','superseded')
+      ))`, sqlutil.QuoteIdentifier(s.table, `"`))
+}
+
+func (s *Postgres) Send(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
 	query := fmt.Sprintf(
-		"UPDATE %s SET status = 'sent', sent_at = $2, claimed_by = NULL, claimed_at = NULL WHERE id = $1",
+		`
+UPDATE %s
+SET status = 'sent',
+    sent_at = $2,
+    last_attempt_at = $2,
+    last_error = NULL,
+    claimed_by = NULL,
+    claimed_at = NULL
+WHERE id = $1
+  AND claimed_by = $3
+  AND lease_token = $4`,
 		sqlutil.QuoteIdentifier(s.table, `"`),
 	)
-	_, err := s.db.ExecContext(ctx, query, id, sendAt)
-	return err
+	args := []any{lease.ID, attempt.At, lease.WorkerID, lease.Token}
+	followups := append(s.attemptHistory(lease, attempt, "sent"), s.archive().move(lease)...)
+	return acknowledge(ctx, s.db, lease, statement{query, args}, followups...)
 }
 
-func (s *Postgres) Retry(ctx context.Context, id int64, retryCount int, nextRetry time.Time) error {
+func (s *Postgres) Retry(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt, nextRetry time.Time) error {
 	query := fmt.Sprintf(
 		`
 UPDATE %s
 SET status = 'retry',
     retry_count = $2,
     next_retry_at = $3,
+    last_error = $6,
+    last_attempt_at = $7,
     claimed_by = NULL,
     claimed_at = NULL
-WHERE id = $1`,
+WHERE id = $1
+  AND claimed_by = $4
+  AND lease_token = $5`,
 		sqlutil.QuoteIdentifier(s.table, `"`),
 	)
-	_, err := s.db.ExecContext(ctx, query, id, retryCount, nextRetry)
-	return err
+	args := []any{lease.ID, attempt.Number, nextRetry, lease.WorkerID, lease.Token, attemptError(attempt.Err), attempt.At}
+	return acknowledge(ctx, s.db, lease, statement{query, args}, s.attemptHistory(lease, attempt, "retry")...)
 }
 
-func (s *Postgres) Fail(ctx context.Context, id int64, retryCount int) error {
+func (s *Postgres) Fail(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
 	query := fmt.Sprintf(
 		`
 UPDATE %s
 SET status = 'failed',
     retry_count = $2,
+    last_error = $5,
+    last_attempt_at = $6,
     claimed_by = NULL,
     claimed_at = NULL
-WHERE id = $1`,
+WHERE id = $1
+  AND claimed_by = $3
+  AND lease_token = $4`,
 		sqlutil.QuoteIdentifier(s.table, `"`),
 	)
-	_, err := s.db.ExecContext(ctx, query, id, retryCount)
-	return err
+	args := []any{lease.ID, attempt.Number, lease.WorkerID, lease.Token, attemptError(attempt.Err), attempt.At}
+	return acknowledge(ctx, s.db, lease, statement{query, args}, s.attemptHistory(lease, attempt, "failed")...)
+}
+
+// ExtendLease pushes the lease expiry to ttl from now if the row is still held by the lease.
+func (s *Postgres) ExtendLease(ctx context.Context, lease txoutbox.Lease, ttl time.Duration) error {
+	query := fmt.Sprintf(
+		`
+UPDATE %s
+SET next_retry_at = $1
+WHERE id = $2
+  AND claimed_by = $3
+  AND lease_token = $4`,
+		sqlutil.QuoteIdentifier(s.table, `"`),
+	)
+	res, err := s.db.ExecContext(ctx, query, s.now().UTC().Add(ttl), lease.ID, lease.WorkerID, lease.Token)
+	return checkLease(res, err, lease)
+}
+
+// Release hands claimed rows back without counting an attempt, making them claimable again at once.
+// Large batches are split so no statement binds more than maxBindParams values.
+func (s *Postgres) Release(ctx context.Context, leases []txoutbox.Lease) (int64, error) {
+	return releaseInChunks(leases, func(chunk []txoutbox.Lease) (int64, error) {
+		return s.release(ctx, chunk)
+	})
+}
+
+func (s *Postgres) release(ctx context.Context, leases []txoutbox.Lease) (int64, error) {
+	match, args := leaseMatch(leases, []any{s.now().UTC()}, func(n int) string { return "$" + strconv.Itoa(n) })
+	query := fmt.Sprintf(`
+UPDATE %s
+SET status = CASE WHEN retry_count > 0 THEN 'retry' ELSE 'pending' END,
+    next_retry_at = $1,
+    claimed_by = NULL,
+    claimed_at = NULL
+WHERE %s`, sqlutil.QuoteIdentifier(s.table, `"`), match)
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SendMany marks every message still held by its lease as sent in one transaction, returning the leases that were
+// lost.
+func (s *Postgres) SendMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, sendSet, func(held []txoutbox.Ack) []statement {
+		return append(bulkHistory(s.attemptsIdent(), held, "sent", func(n int) string { return "$" + strconv.Itoa(n) }), s.archive().moveMany(held)...)
+	})
+}
+
+// RetryMany schedules every message still held by its lease for another attempt in one transaction, returning the
+// leases that were lost.
+func (s *Postgres) RetryMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, retrySet, func(held []txoutbox.Ack) []statement {
+		return bulkHistory(s.attemptsIdent(), held, "retry", func(n int) string { return "$" + strconv.Itoa(n) })
+	})
+}
+
+// FailMany marks every message still held by its lease permanently failed in one transaction, returning the leases
+// that were lost.
+func (s *Postgres) FailMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, failSet, func(held []txoutbox.Ack) []statement {
+		return bulkHistory(s.attemptsIdent(), held, "failed", func(n int) string { return "$" + strconv.Itoa(n) })
+	})
+}
+
+func (s *Postgres) bulk() bulkAcks {
+	return bulkAcks{
+		db:          s.db,
+		table:       sqlutil.QuoteIdentifier(s.table, `"`),
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		cast:        func(marker, sqlType string) string { return marker + "::" + sqlType },
+		lock:        " FOR UPDATE",
+		inIDs: func(ids []int64, args []any) (string, []any) {
+			args = append(args, ids)
+			return "id = ANY($" + strconv.Itoa(len(args)) + ")", args
+		},
+	}
+}
+
+// attemptsIdent returns the quoted attempts table, or an empty string when attempt history is off.
+func (s *Postgres) attemptsIdent() string {
+	if s.attemptsTable == "" {
+		return ""
+	}
+	return sqlutil.QuoteIdentifier(s.attemptsTable, `"`)
+}
+
+// attemptHistory returns the insert recording an attempt, or nothing when no attempts table is configured.
+func (s *Postgres) attemptHistory(lease txoutbox.Lease, attempt txoutbox.Attempt, status string) []statement {
+	if s.attemptsTable == "" {
+		return nil
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		sqlutil.QuoteIdentifier(s.attemptsTable, `"`), historyColumns, numberedPlaceholders(1, 7),
+	)
+	return []statement{{query, historyValues(lease, attempt, status)}}
+}
+
+// ListFailed returns permanently failed messages matching filter, ordered by ID.
+func (s *Postgres) ListFailed(ctx context.Context, filter txoutbox.DeadLetterFilter, page txoutbox.Page) ([]txoutbox.DeadLetter, error) {
+	return s.deadLetters().list(ctx, filter, page)
+}
+
+// GetFailed returns a single permanently failed message, or txoutbox.ErrNotFound.
+func (s *Postgres) GetFailed(ctx context.Context, id int64) (txoutbox.DeadLetter, error) {
+	return s.deadLetters().get(ctx, id)
+}
+
+// RequeueFailed makes matching failed messages claimable again with retry_count reset to zero.
+func (s *Postgres) RequeueFailed(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	return s.deadLetters().requeue(ctx, filter)
+}
+
+// DiscardFailed deletes matching failed messages along with their attempt history.
+func (s *Postgres) DiscardFailed(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	return s.deadLetters().discard(ctx, filter)
+}
+
+func (s *Postgres) deadLetters() deadLetters {
+	return deadLetters{
+		db:          s.db,
+		table:       sqlutil.QuoteIdentifier(s.table, `"`),
+		keyColumn:   "key",
+		attempts:    s.attemptsIdent(),
+		now:         s.now,
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		contains:    func(marker string) string { return "strpos(last_error, " + marker + ") > 0" },
+	}
+}
+
+// PurgeSent deletes up to limit sent messages delivered before the cutoff, along with their attempt history.
+func (s *Postgres) PurgeSent(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.purge(ctx, sqlutil.QuoteIdentifier(s.table, `"`), "status = 'sent' AND sent_at < $1", before, limit)
+}
+
+// PurgeFailed deletes up to limit failed messages whose final attempt happened before the cutoff.
+// Rows failed before last_attempt_at was tracked fall back to created_at.
+func (s *Postgres) PurgeFailed(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.purge(ctx, sqlutil.QuoteIdentifier(s.table, `"`), "status = 'failed' AND COALESCE(last_attempt_at, created_at) < $1", before, limit)
+}
+
+func (s *Postgres) purge(ctx context.Context, table, cond string, before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, fmt.Errorf("txoutbox: batch size must be positive")
+	}
+	var attempts string
+	if s.attemptsTable != "" {
+		attempts = sqlutil.QuoteIdentifier(s.attemptsTable, `"`)
+	}
+	query := fmt.Sprintf("SELECT id FROM %s WHERE %s ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED", table, cond)
+	return purgeRows(ctx, s.db, table, attempts, query, []any{before.UTC(), limit}, func(n int) string { return numberedPlaceholders(1, n) })
+}
+
+// ListArchived returns messages moved to the archive table, ordered by ID.
+func (s *Postgres) ListArchived(ctx context.Context, filter txoutbox.ArchiveFilter, page txoutbox.Page) ([]txoutbox.ArchivedMessage, error) {
+	return s.archive().list(ctx, filter, page)
+}
+
+// PurgeArchived deletes up to limit archived messages delivered before the cutoff, along with their attempt history.
+func (s *Postgres) PurgeArchived(ctx context.Context, before time.Time, limit int) (int64, error) {
+	table := s.archive().table
+	if table == "" {
+		return 0, txoutbox.ErrNoArchive
+	}
+	return s.purge(ctx, table, "sent_at < $1", before, limit)
+}
+
+func (s *Postgres) archive() archive {
+	var table string
+	if s.archiveTable != "" {
+		table = sqlutil.QuoteIdentifier(s.archiveTable, `"`)
+	}
+	return archive{
+		db:          s.db,
+		table:       table,
+		source:      sqlutil.QuoteIdentifier(s.table, `"`),
+		keyColumn:   `"key"`,
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	}
+}
+
+// numberedPlaceholders renders n Postgres placeholders starting at $start.
+func numberedPlaceholders(start, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = "$" + strconv.Itoa(start+i)
+	}
+	return strings.Join(parts, ", ")
 }
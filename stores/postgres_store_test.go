@@ -3,7 +3,9 @@ package stores_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -24,14 +26,15 @@ func TestPostgresStoreLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("begin tx: %v", err)
 	}
-	if err := store.Add(ctx, tx, txoutbox.Message{
+	id, err := store.Add(ctx, tx, txoutbox.Message{
 		Topic: "order.created",
 		Key:   "order-1",
 		Body: map[string]any{
 			"id":    1,
 			"total": 100,
 		},
-	}); err != nil {
+	})
+	if err != nil {
 		t.Fatalf("Add error: %v", err)
 	}
 	if err := tx.Commit(); err != nil {
@@ -45,11 +48,25 @@ func TestPostgresStoreLifecycle(t *testing.T) {
 	if len(envs) != 1 {
 		t.Fatalf("expected 1 envelope, got %d", len(envs))
 	}
+	if envs[0].ID != id {
+		t.Fatalf("envelope ID = %d, want %d returned by Add", envs[0].ID, id)
+	}
 
-	if err := store.Retry(ctx, envs[0].ID, envs[0].RetryCount+1, time.Now().UTC().Add(time.Minute)); err != nil {
+	if err := store.Retry(ctx, envs[0].Lease(), txoutbox.Attempt{Number: envs[0].RetryCount + 1, At: time.Now().UTC()}, time.Now().UTC().Add(-time.Minute)); err != nil {
 		t.Fatalf("Retry error: %v", err)
 	}
-	if err := store.Fail(ctx, envs[0].ID, envs[0].RetryCount+2); err != nil {
+
+	reclaimed, err := store.Claim(ctx, "worker-1", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("reclaim error: %v", err)
+	}
+	if len(reclaimed) != 1 {
+		t.Fatalf("expected 1 envelope on reclaim, got %d", len(reclaimed))
+	}
+	if reclaimed[0].LeaseToken <= envs[0].LeaseToken {
+		t.Fatalf("lease token = %d, want > %d", reclaimed[0].LeaseToken, envs[0].LeaseToken)
+	}
+	if err := store.Fail(ctx, reclaimed[0].Lease(), txoutbox.Attempt{Number: reclaimed[0].RetryCount + 1, At: time.Now().UTC()}); err != nil {
 		t.Fatalf("Fail error: %v", err)
 	}
 
@@ -147,6 +164,613 @@ func TestPostgresStoreClaimConcurrentWorkers(t *testing.T) {
 	}
 }
 
+func TestPostgresStoreRejectsStaleLease(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	seedPostgresMessages(t, ctx, db, 1)
+
+	stale, err := store.Claim(ctx, "worker-stale", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(stale) != 1 {
+		t.Fatalf("expected 1 envelope, got %d", len(stale))
+	}
+
+	if _, err := db.ExecContext(ctx,
+		`UPDATE txoutbox SET next_retry_at = NOW() - INTERVAL '1 second' WHERE id = $1`,
+		stale[0].ID,
+	); err != nil {
+		t.Fatalf("expire lease: %v", err)
+	}
+
+	fresh, err := store.Claim(ctx, "worker-fresh", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("reclaim error: %v", err)
+	}
+	if len(fresh) != 1 {
+		t.Fatalf("expected 1 envelope after lease expiry, got %d", len(fresh))
+	}
+
+	if err := store.Send(ctx, stale[0].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("stale Send error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+	if err := store.Fail(ctx, stale[0].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("stale Fail error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+	if err := store.Send(ctx, fresh[0].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+}
+
+func TestPostgresStoreOrderedKeys(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db, stores.WithPostgresOrderedKeys(true))
+	for _, msg := range []txoutbox.Message{
+		{Topic: "order.created", Key: "order-1", Body: map[string]any{"seq": 1}},
+		{Topic: "order.paid", Key: "order-1", Body: map[string]any{"seq": 2}},
+		{Topic: "order.created", Key: "order-2", Body: map[string]any{"seq": 3}},
+	} {
+		if _, err := store.Add(ctx, db, msg); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	first, err := store.Claim(ctx, "worker-a", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("expected 2 envelopes (one per key), got %v", envelopeTopics(first))
+	}
+
+	blocked, err := store.Claim(ctx, "worker-b", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(blocked) != 0 {
+		t.Fatalf("expected no envelopes while order-1 is in flight, got %v", envelopeTopics(blocked))
+	}
+
+	if err := store.Send(ctx, first[0].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	next, err := store.Claim(ctx, "worker-b", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if got := envelopeTopics(next); len(got) != 1 || got[0] != "order.paid" {
+		t.Fatalf("claim after send topics = %v, want [order.paid]", got)
+	}
+}
+
+func TestPostgresStoreScheduledCancel(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	deliverAt := time.Now().UTC().Add(24 * time.Hour)
+	for _, msg := range []txoutbox.Message{
+		{Topic: "reminder", Key: "order-1", Body: map[string]any{"n": 1}, DeliverAt: deliverAt},
+		{Topic: "timeout", Key: "order-1", Body: map[string]any{"n": 2}, DeliverAt: deliverAt},
+		{Topic: "reminder", Key: "order-2", Body: map[string]any{"n": 3}},
+	} {
+		if _, err := store.Add(ctx, db, msg); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 1 || envs[0].Topic != "reminder" {
+		t.Fatalf("expected only the unscheduled message, got %v", envelopeTopics(envs))
+	}
+
+	n, err := store.CancelByKey(ctx, db, "order-1")
+	if err != nil {
+		t.Fatalf("CancelByKey error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("CancelByKey cancelled %d rows, want 2", n)
+	}
+	if ok, err := store.Cancel(ctx, db, envs[0].ID); err != nil || ok {
+		t.Fatalf("Cancel of leased row = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestPostgresStoreHeaders(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	headers := map[string]string{"correlation-id": "abc-123", "content-type": "application/json"}
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "with.headers", Body: map[string]any{"n": 1}, Headers: headers}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 1 {
+		t.Fatalf("expected 1 envelope, got %d", len(envs))
+	}
+	if got := envs[0].Headers; len(got) != 2 || got["correlation-id"] != "abc-123" || got["content-type"] != "application/json" {
+		t.Fatalf("headers = %v, want %v", got, headers)
+	}
+}
+
+func TestPostgresStoreLastError(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox, txoutbox_attempts`)
+
+	store := stores.NewPostgres(db, stores.WithPostgresAttemptsTable("txoutbox_attempts"))
+	seedPostgresMessages(t, ctx, db, 1)
+
+	envs, err := store.Claim(ctx, "worker", 1, time.Minute)
+	if err != nil || len(envs) != 1 {
+		t.Fatalf("Claim = %d envelopes, %v; want 1, nil", len(envs), err)
+	}
+	attempt := txoutbox.Attempt{Number: 1, At: time.Now().UTC(), Duration: time.Second, Err: errors.New("boom")}
+	if err := store.Fail(ctx, envs[0].Lease(), attempt); err != nil {
+		t.Fatalf("Fail error: %v", err)
+	}
+
+	var lastError string
+	if err := db.QueryRowContext(ctx, `SELECT last_error FROM txoutbox WHERE id = $1`, envs[0].ID).Scan(&lastError); err != nil {
+		t.Fatalf("select last_error: %v", err)
+	}
+	if lastError != "boom" {
+		t.Fatalf("last_error = %q, want boom", lastError)
+	}
+	var status string
+	var durationMS int64
+	if err := db.QueryRowContext(ctx,
+		`SELECT status, duration_ms FROM txoutbox_attempts WHERE message_id = $1`, envs[0].ID,
+	).Scan(&status, &durationMS); err != nil {
+		t.Fatalf("select attempt: %v", err)
+	}
+	if status != "failed" || durationMS != 1000 {
+		t.Fatalf("attempt = (%s, %d), want (failed, 1000)", status, durationMS)
+	}
+}
+
+func TestPostgresStoreDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	seedPostgresMessages(t, ctx, db, 2)
+
+	envs, err := store.Claim(ctx, "worker", 2, time.Minute)
+	if err != nil || len(envs) != 2 {
+		t.Fatalf("Claim = %d envelopes, %v; want 2, nil", len(envs), err)
+	}
+	for i, env := range envs {
+		attempt := txoutbox.Attempt{Number: 5, At: time.Now().UTC(), Err: fmt.Errorf("failure %d", i)}
+		if err := store.Fail(ctx, env.Lease(), attempt); err != nil {
+			t.Fatalf("Fail error: %v", err)
+		}
+	}
+
+	letters, err := store.ListFailed(ctx, txoutbox.DeadLetterFilter{ErrorContains: "failure 1"}, txoutbox.Page{})
+	if err != nil || len(letters) != 1 || letters[0].ID != envs[1].ID || letters[0].LastError != "failure 1" {
+		t.Fatalf("ListFailed = %+v, %v; want id=%d", letters, err, envs[1].ID)
+	}
+
+	requeued, err := store.RequeueFailed(ctx, txoutbox.DeadLetterFilter{IDs: []int64{envs[0].ID}})
+	if err != nil || requeued != 1 {
+		t.Fatalf("RequeueFailed = %d, %v; want 1, nil", requeued, err)
+	}
+	replay, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil || len(replay) != 1 || replay[0].ID != envs[0].ID || replay[0].RetryCount != 0 {
+		t.Fatalf("replay = %+v, %v; want id=%d with retry_count 0", replay, err, envs[0].ID)
+	}
+
+	if _, err := store.DiscardFailed(ctx, txoutbox.DeadLetterFilter{}); !errors.Is(err, txoutbox.ErrEmptyFilter) {
+		t.Fatalf("DiscardFailed with an empty filter error = %v, want %v", err, txoutbox.ErrEmptyFilter)
+	}
+	discarded, err := store.DiscardFailed(ctx, txoutbox.DeadLetterFilter{All: true})
+	if err != nil || discarded != 1 {
+		t.Fatalf("DiscardFailed = %d, %v; want 1, nil", discarded, err)
+	}
+	if _, err := store.GetFailed(ctx, envs[1].ID); !errors.Is(err, txoutbox.ErrNotFound) {
+		t.Fatalf("GetFailed error = %v, want %v", err, txoutbox.ErrNotFound)
+	}
+}
+
+func TestPostgresStorePurge(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	seedPostgresMessages(t, ctx, db, 3)
+
+	envs, err := store.Claim(ctx, "worker", 3, time.Minute)
+	if err != nil || len(envs) != 3 {
+		t.Fatalf("Claim = %d envelopes, %v; want 3, nil", len(envs), err)
+	}
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	for _, env := range envs[:2] {
+		if err := store.Send(ctx, env.Lease(), txoutbox.Attempt{Number: 1, At: old}); err != nil {
+			t.Fatalf("Send error: %v", err)
+		}
+	}
+	if err := store.Send(ctx, envs[2].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	n, err := store.PurgeSent(ctx, time.Now().UTC().Add(-24*time.Hour), 1)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeSent = %d, %v; want 1, nil", n, err)
+	}
+	n, err = store.PurgeSent(ctx, time.Now().UTC().Add(-24*time.Hour), 10)
+	if err != nil || n != 1 {
+		t.Fatalf("second PurgeSent = %d, %v; want 1, nil", n, err)
+	}
+	var remaining int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM txoutbox`).Scan(&remaining); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("remaining rows = %d, want 1", remaining)
+	}
+}
+
+func TestPostgresStoreArchive(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox, txoutbox_archive`)
+
+	store := stores.NewPostgres(db, stores.WithPostgresArchiveTable("txoutbox_archive"))
+	seedPostgresMessages(t, ctx, db, 2)
+
+	envs, err := store.Claim(ctx, "worker", 2, time.Minute)
+	if err != nil || len(envs) != 2 {
+		t.Fatalf("Claim = %d envelopes, %v; want 2, nil", len(envs), err)
+	}
+	if err := store.Send(ctx, envs[0].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	var remaining int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM txoutbox`).Scan(&remaining); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("outbox rows = %d, want 1", remaining)
+	}
+	archived, err := store.ListArchived(ctx, txoutbox.ArchiveFilter{Topic: "order.created"}, txoutbox.Page{})
+	if err != nil {
+		t.Fatalf("ListArchived error: %v", err)
+	}
+	if len(archived) != 1 || archived[0].ID != envs[0].ID || archived[0].ClaimedBy != "worker" {
+		t.Fatalf("archived = %+v, want id=%d claimed by worker", archived, envs[0].ID)
+	}
+	n, err := store.PurgeArchived(ctx, time.Now().UTC().Add(time.Hour), 10)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeArchived = %d, %v; want 1, nil", n, err)
+	}
+}
+
+func TestPostgresStoreNotify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db, stores.WithPostgresNotify("txoutbox_test"))
+	wake, err := stores.NewPostgresNotifier(db, "txoutbox_test").Listen(ctx)
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	// The first wake-up signals that LISTEN is active.
+	select {
+	case <-wake:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for LISTEN")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	if _, err := store.Add(ctx, tx, txoutbox.Message{Topic: "notified", Body: map[string]any{"n": 1}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	select {
+	case <-wake:
+		t.Fatal("woke before commit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	select {
+	case <-wake:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for notification")
+	}
+}
+
+func TestPostgresStoreRelease(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	seedPostgresMessages(t, ctx, db, 2)
+
+	envs, err := store.Claim(ctx, "worker-a", 2, time.Hour)
+	if err != nil || len(envs) != 2 {
+		t.Fatalf("Claim = %d envelopes, %v; want 2, nil", len(envs), err)
+	}
+	n, err := store.Release(ctx, []txoutbox.Lease{envs[0].Lease(), envs[1].Lease()})
+	if err != nil || n != 2 {
+		t.Fatalf("Release = %d, %v; want 2, nil", n, err)
+	}
+	reclaimed, err := store.Claim(ctx, "worker-b", 10, time.Hour)
+	if err != nil || len(reclaimed) != 2 {
+		t.Fatalf("Claim after release = %d envelopes, %v; want 2, nil", len(reclaimed), err)
+	}
+	if err := store.Send(ctx, envs[0].Lease(), txoutbox.Attempt{Number: 1, At: time.Now().UTC()}); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("Send with released lease error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+}
+
+func TestPostgresStoreExtendLease(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	now := time.Now().UTC().Add(time.Second)
+	store := stores.NewPostgres(db, stores.WithPostgresNow(func() time.Time { return now }))
+	seedPostgresMessages(t, ctx, db, 1)
+
+	envs, err := store.Claim(ctx, "worker-a", 1, time.Minute)
+	if err != nil || len(envs) != 1 {
+		t.Fatalf("Claim = %d envelopes, %v; want 1, nil", len(envs), err)
+	}
+	now = now.Add(50 * time.Second)
+	if err := store.ExtendLease(ctx, envs[0].Lease(), time.Minute); err != nil {
+		t.Fatalf("ExtendLease error: %v", err)
+	}
+	if err := store.ExtendLease(ctx, envs[0].Lease(), time.Minute); err != nil {
+		t.Fatalf("repeated ExtendLease error: %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	stolen, err := store.Claim(ctx, "worker-b", 1, time.Minute)
+	if err != nil || len(stolen) != 0 {
+		t.Fatalf("Claim of extended lease = %d envelopes, %v; want 0, nil", len(stolen), err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := store.Claim(ctx, "worker-b", 1, time.Minute); err != nil {
+		t.Fatalf("Claim after expiry error: %v", err)
+	}
+	if err := store.ExtendLease(ctx, envs[0].Lease(), time.Minute); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("ExtendLease of re-claimed row error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+}
+
+func TestPostgresStoreBulkAcknowledgements(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	seedPostgresMessages(t, ctx, db, 4)
+
+	envs, err := store.Claim(ctx, "worker-a", 4, time.Hour)
+	if err != nil || len(envs) != 4 {
+		t.Fatalf("Claim = %d envelopes, %v; want 4, nil", len(envs), err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	ack := func(env txoutbox.Envelope, err error) txoutbox.Ack {
+		return txoutbox.Ack{Lease: env.Lease(), Attempt: txoutbox.Attempt{Number: 1, At: now, Err: err}, NextRetry: now.Add(time.Hour)}
+	}
+	stale := ack(envs[3], nil)
+	stale.Lease.Token--
+
+	lost, err := store.SendMany(ctx, []txoutbox.Ack{ack(envs[0], nil), stale})
+	if err != nil || len(lost) != 1 || lost[0] != stale.Lease {
+		t.Fatalf("SendMany = %v, %v; want the stale lease lost", lost, err)
+	}
+	if _, err := store.RetryMany(ctx, []txoutbox.Ack{ack(envs[1], errors.New("timeout"))}); err != nil {
+		t.Fatalf("RetryMany error: %v", err)
+	}
+	if _, err := store.FailMany(ctx, []txoutbox.Ack{ack(envs[2], errors.New("rejected"))}); err != nil {
+		t.Fatalf("FailMany error: %v", err)
+	}
+
+	for i, want := range []string{"sent", "retry", "failed", "sending"} {
+		var status string
+		if err := db.QueryRowContext(ctx, "SELECT status FROM txoutbox WHERE id = $1", envs[i].ID).Scan(&status); err != nil {
+			t.Fatalf("select status: %v", err)
+		}
+		if status != want {
+			t.Fatalf("status of id=%d = %s, want %s", envs[i].ID, status, want)
+		}
+	}
+	var nextRetry time.Time
+	if err := db.QueryRowContext(ctx, "SELECT next_retry_at FROM txoutbox WHERE id = $1", envs[1].ID).Scan(&nextRetry); err != nil {
+		t.Fatalf("select next_retry_at: %v", err)
+	}
+	if !nextRetry.Equal(now.Add(time.Hour)) {
+		t.Fatalf("next_retry_at = %s, want %s", nextRetry, now.Add(time.Hour))
+	}
+}
+
+func TestPostgresStoreAddMany(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	msgs := []txoutbox.Message{
+		{Topic: "bulk.1", Key: "k1", Body: map[string]any{"n": 1}},
+		{Topic: "bulk.2", Body: map[string]any{"n": 2}, Headers: map[string]string{"tenant-id": "acme"}},
+	}
+	// *sql.DB goes through multi-row INSERTs.
+	if err := store.AddMany(ctx, db, msgs); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := store.AddMany(ctx, tx, []txoutbox.Message{{Topic: "bulk.3", Body: map[string]any{"n": 3}, Headers: map[string]string{"tenant-id": "acme"}}}); err != nil {
+		t.Fatalf("AddMany in tx error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 3 {
+		t.Fatalf("expected 3 envelopes, got %d", len(envs))
+	}
+	for i, topic := range []string{"bulk.1", "bulk.2", "bulk.3"} {
+		if envs[i].Topic != topic {
+			t.Fatalf("envelope %d topic = %s, want %s", i, envs[i].Topic, topic)
+		}
+	}
+	if envs[2].Headers["tenant-id"] != "acme" {
+		t.Fatalf("headers = %v", envs[2].Headers)
+	}
+
+	if err := store.AddMany(ctx, db, []txoutbox.Message{{Topic: "bulk.ok", Body: 1}, {Topic: "bulk.bad", Body: make(chan int)}}); err == nil {
+		t.Fatal("expected AddMany to reject an unmarshalable body")
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&count); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("rows = %d, want 3", count)
+	}
+}
+
+func TestPostgresStoreDedupKey(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	msg := txoutbox.Message{Topic: "dedup", Body: map[string]any{"n": 1}, DedupKey: "req-1"}
+	if _, err := store.Add(ctx, tx, msg); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if _, err := store.Add(ctx, tx, msg); !errors.Is(err, txoutbox.ErrDuplicate) {
+		t.Fatalf("Add duplicate error = %v, want ErrDuplicate", err)
+	}
+	// The duplicate must not have aborted the transaction.
+	if _, err := store.Add(ctx, tx, txoutbox.Message{Topic: "dedup", Body: map[string]any{"n": 2}, DedupKey: "req-2"}); err != nil {
+		t.Fatalf("Add after duplicate error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	if err := store.AddMany(ctx, db, []txoutbox.Message{
+		{Topic: "dedup", Body: map[string]any{"n": 3}, DedupKey: "req-2"},
+		{Topic: "dedup", Body: map[string]any{"n": 4}, DedupKey: "req-3"},
+	}); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&count); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("rows = %d, want 3", count)
+	}
+
+	later := stores.NewPostgres(db,
+		stores.WithPostgresDedupWindow(time.Hour),
+		stores.WithPostgresNow(func() time.Time { return time.Now().Add(2 * time.Hour) }),
+	)
+	if _, err := later.Add(ctx, db, msg); err != nil {
+		t.Fatalf("Add after window error: %v", err)
+	}
+}
+
+func TestPostgresStoreCoalescedTopics(t *testing.T) {
+	ctx := context.Background()
+	db := database.OpenPostgres(t)
+	_, _ = db.ExecContext(ctx, `TRUNCATE txoutbox`)
+
+	store := stores.NewPostgres(db, stores.WithPostgresCoalescedTopics("entity.state"), stores.WithPostgresOrderedKeys(true))
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	for v := 1; v <= 3; v++ {
+		if _, err := store.Add(ctx, tx, txoutbox.Message{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": v}}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	if _, err := store.Add(ctx, tx, txoutbox.Message{Topic: "entity.state", Key: "user-2", Body: map[string]any{"v": 1}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	var superseded int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox WHERE status = 'superseded'").Scan(&superseded); err != nil {
+		t.Fatalf("count superseded: %v", err)
+	}
+	if superseded != 2 {
+		t.Fatalf("superseded rows = %d, want 2", superseded)
+	}
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 2 {
+		t.Fatalf("expected 2 envelopes, got %d", len(envs))
+	}
+	for _, env := range envs {
+		want := 0
+		if *env.Key == "user-1" {
+			want = 2
+		}
+		if env.Supersedes != want {
+			t.Fatalf("envelope %s supersedes = %d, want %d", *env.Key, env.Supersedes, want)
+		}
+	}
+}
+
+func TestPostgresNotifierRejectsOtherDrivers(t *testing.T) {
+	db := database.OpenSQLite(t)
+	wake, err := stores.NewPostgresNotifier(db, "txoutbox_test").Listen(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "requires the pgx driver") {
+		t.Fatalf("Listen = %v, %v; want the driver error", wake, err)
+	}
+}
+
 func seedPostgresMessages(t *testing.T, ctx context.Context, db *sql.DB, count int) {
 	t.Helper()
 	for i := 0; i < count; i++ {
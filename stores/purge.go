@@ -0,0 +1,57 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// purgeRows deletes the rows returned by the candidates query, plus their attempt history when attempts is set,
+// in one transaction. candidates must select ids and carry its own LIMIT so each call stays bounded; list
+// renders the placeholders for an IN list of n ids.
+func purgeRows(ctx context.Context, db *sql.DB, table, attempts, candidates string, args []any, list func(n int) string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, candidates, args...)
+	if err != nil {
+		return 0, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", table, list(len(ids))), ids...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if attempts != "" {
+		query := fmt.Sprintf("DELETE FROM %s WHERE message_id IN (%s)", attempts, list(len(ids)))
+		if _, err := tx.ExecContext(ctx, query, ids...); err != nil {
+			return 0, err
+		}
+	}
+	return n, tx.Commit()
+}
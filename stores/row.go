@@ -0,0 +1,139 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mickamy/txoutbox"
+)
+
+// insertRow returns the columns and values Add writes for msg; keyColumn is the dialect-quoted key column name.
+func insertRow(msg txoutbox.Message, keyColumn string, trace txoutbox.TraceContext) ([]string, []any, error) {
+	payload, err := msg.MarshalPayload()
+	if err != nil {
+		return nil, nil, err
+	}
+	var key any
+	if msg.Key != "" {
+		key = msg.Key
+	}
+	columns := []string{"topic", keyColumn, "payload"}
+	values := []any{msg.Topic, key, payload}
+	if len(msg.Headers) > 0 {
+		headers, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return nil, nil, fmt.Errorf("txoutbox: failed to marshal headers: %w", err)
+		}
+		columns = append(columns, "headers")
+		values = append(values, string(headers))
+	}
+	if !trace.IsZero() {
+		columns = append(columns, "traceparent", "tracestate")
+		values = append(values, trace.TraceParent, trace.TraceState)
+	}
+	if !msg.DeliverAt.IsZero() {
+		columns = append(columns, "next_retry_at")
+		values = append(values, msg.DeliverAt.UTC())
+	}
+	if msg.DedupKey != "" {
+		columns = append(columns, dedupColumn)
+		values = append(values, msg.DedupKey)
+	}
+	return columns, values, nil
+}
+
+// maxBindParams caps the values bound by one multi-row INSERT, staying under SQLite's default limit of 32766 and
+// well under the 65535 accepted by PostgreSQL and MySQL.
+const maxBindParams = 32766
+
+// insertRun is a sequence of consecutive messages writing the same columns, so they can share one INSERT.
+type insertRun struct {
+	columns []string
+	rows    [][]any
+}
+
+// insertRuns encodes every message before anything is written, so one invalid message fails the whole batch.
+// Only consecutive rows are grouped, keeping ids in slice order.
+func insertRuns(msgs []txoutbox.Message, keyColumn string, trace txoutbox.TraceContext) ([]insertRun, error) {
+	var runs []insertRun
+	for i, msg := range msgs {
+		columns, values, err := insertRow(msg, keyColumn, trace)
+		if err != nil {
+			return nil, fmt.Errorf("txoutbox: message %d: %w", i, err)
+		}
+		if n := len(runs); n > 0 && slices.Equal(runs[n-1].columns, columns) {
+			runs[n-1].rows = append(runs[n-1].rows, values)
+			continue
+		}
+		runs = append(runs, insertRun{columns: columns, rows: [][]any{values}})
+	}
+	return runs, nil
+}
+
+// insertMany writes runs with multi-row INSERTs into table (already quoted), splitting a run whenever a statement
+// would bind more than maxBindParams values. Runs carrying dedup keys skip rows whose key is already taken.
+func insertMany(
+	ctx context.Context,
+	exec txoutbox.Executor,
+	table string,
+	runs []insertRun,
+	placeholder func(n int) string,
+	skip dedupSkip,
+) error {
+	for _, run := range runs {
+		suffix := skip.suffix(run.columns)
+		perStatement := max(1, maxBindParams/len(run.columns))
+		for start := 0; start < len(run.rows); start += perStatement {
+			chunk := run.rows[start:min(start+perStatement, len(run.rows))]
+			args := make([]any, 0, len(chunk)*len(run.columns))
+			tuples := make([]string, len(chunk))
+			for i, row := range chunk {
+				marks := make([]string, len(row))
+				for j, v := range row {
+					args = append(args, v)
+					marks[j] = placeholder(len(args))
+				}
+				tuples[i] = "(" + strings.Join(marks, ", ") + ")"
+			}
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s", table, strings.Join(run.columns, ", "), strings.Join(tuples, ", "), suffix)
+			if _, err := exec.ExecContext(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// injectTrace captures the trace context from ctx when a propagator is configured.
+func injectTrace(ctx context.Context, p txoutbox.Propagator) txoutbox.TraceContext {
+	if p == nil {
+		return txoutbox.TraceContext{}
+	}
+	return p.Inject(ctx)
+}
+
+// decodeHeaders parses the headers column; NULL or empty values yield nil.
+func decodeHeaders(raw []byte) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		return nil, fmt.Errorf("txoutbox: failed to decode headers: %w", err)
+	}
+	return headers, nil
+}
+
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = "?"
+	}
+	return strings.Join(parts, ",")
+}
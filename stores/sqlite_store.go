@@ -3,7 +3,9 @@ package stores
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mickamy/txoutbox"
@@ -12,9 +14,19 @@ import (
 
 // SQLite implements Store for SQLite databases.
 type SQLite struct {
-	db    *sql.DB
-	table string
-	now   func() time.Time
+	db          *sql.DB
+	table       string
+	now         func() time.Time
+	orderedKeys bool
+	propagator  txoutbox.Propagator
+	// attemptsTable optionally records every delivery attempt; empty disables the history.
+	attemptsTable string
+	// archiveTable receives sent rows in archive mode; empty keeps them in the outbox table.
+	archiveTable string
+	// dedupWindow bounds how long a DedupKey rejects duplicates; zero keeps it for the row's lifetime.
+	dedupWindow time.Duration
+	// coalescedTopics lists the topics whose messages supersede pending ones with the same key.
+	coalescedTopics map[string]bool
 }
 
 // SQLiteOption configures a SQLite.
@@ -38,6 +50,53 @@ func WithSQLiteNow(now func() time.Time) SQLiteOption {
 	}
 }
 
+// WithSQLiteOrderedKeys makes Claim skip a keyed message until every earlier message with the same key
+// is sent, failed or cancelled, so messages sharing a key are delivered one at a time in insertion order.
+func WithSQLiteOrderedKeys(enabled bool) SQLiteOption {
+	return func(s *SQLite) {
+		s.orderedKeys = enabled
+	}
+}
+
+// WithSQLitePropagator captures the caller's trace context in Add so the relay can restore it on delivery.
+func WithSQLitePropagator(p txoutbox.Propagator) SQLiteOption {
+	return func(s *SQLite) {
+		s.propagator = p
+	}
+}
+
+// WithSQLiteAttemptsTable records every delivery attempt (worker, time, duration, error) in the given table.
+func WithSQLiteAttemptsTable(table string) SQLiteOption {
+	return func(s *SQLite) {
+		s.attemptsTable = table
+	}
+}
+
+// WithSQLiteArchiveTable turns on archive mode: Send moves each delivered row into the given table, keeping the
+// outbox table small for Claim while retaining sent events for audit. An archived row no longer holds its DedupKey.
+func WithSQLiteArchiveTable(table string) SQLiteOption {
+	return func(s *SQLite) {
+		s.archiveTable = table
+	}
+}
+
+// WithSQLiteDedupWindow limits deduplication to messages enqueued within d: Add first clears the DedupKey of older
+// rows so the key can be reused. Zero (the default) rejects a key for as long as a row holding it exists.
+func WithSQLiteDedupWindow(d time.Duration) SQLiteOption {
+	return func(s *SQLite) {
+		s.dedupWindow = d
+	}
+}
+
+// WithSQLiteCoalescedTopics makes messages on the given topics latest-wins: Add marks every still-pending message
+// with the same topic and key as 'superseded', so the relay only ships the newest state. Messages already claimed
+// are still delivered, and messages without a key never coalesce.
+func WithSQLiteCoalescedTopics(topics ...string) SQLiteOption {
+	return func(s *SQLite) {
+		s.coalescedTopics = topicSet(topics)
+	}
+}
+
 // NewSQLite creates a Store backed by SQLite.
 func NewSQLite(db *sql.DB, opts ...SQLiteOption) *SQLite {
 	store := &SQLite{
@@ -51,19 +110,85 @@ func NewSQLite(db *sql.DB, opts ...SQLiteOption) *SQLite {
 	return store
 }
 
-// Add inserts a new message row within the caller's transaction.
-func (s *SQLite) Add(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message) error {
-	payload, err := msg.MarshalPayload()
+// Add inserts a new message row within the caller's transaction and returns its ID.
+// A message with a DedupKey is written with ON CONFLICT (dedup_key) DO NOTHING and reports txoutbox.ErrDuplicate
+// when nothing was inserted.
+func (s *SQLite) Add(ctx context.Context, exec txoutbox.Executor, msg txoutbox.Message) (int64, error) {
+	columns, values, err := insertRow(msg, "key", injectTrace(ctx, s.propagator))
+	if err != nil {
+		return 0, err
+	}
+	if err := releaseDedupKeys(ctx, exec, s.tableIdent(), []txoutbox.Message{msg}, s.dedupCutoff(), questionMark); err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)%s RETURNING id", s.tableIdent(), strings.Join(columns, ", "), placeholders(len(values)), sqliteDedup.suffix(columns))
+	var id int64
+	if err := exec.QueryRowContext(ctx, query, values...).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, txoutbox.ErrDuplicate
+		}
+		return 0, err
+	}
+	if err := s.coalescing().supersede(ctx, exec, msg, id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// coalescing returns the latest-wins settings for Add.
+func (s *SQLite) coalescing() coalescing {
+	return coalescing{
+		topics:      s.coalescedTopics,
+		table:       s.tableIdent(),
+		keyColumn:   "key",
+		placeholder: questionMark,
+		lockedCount: countSupersedes,
+	}
+}
+
+// dedupCutoff returns the creation time before which dedup keys no longer count, or zero without a window.
+func (s *SQLite) dedupCutoff() time.Time {
+	if s.dedupWindow <= 0 {
+		return time.Time{}
+	}
+	return s.now().UTC().Add(-s.dedupWindow)
+}
+
+// AddMany enqueues msgs in order with multi-row INSERTs, validating every message before writing any. Batches
+// touching coalesced topics are added one message at a time so each supersedes its predecessors.
+func (s *SQLite) AddMany(ctx context.Context, exec txoutbox.Executor, msgs []txoutbox.Message) error {
+	runs, err := insertRuns(msgs, "key", injectTrace(ctx, s.propagator))
 	if err != nil {
 		return err
 	}
-	query := fmt.Sprintf("INSERT INTO %s (topic, key, payload) VALUES (?, ?, ?)", s.tableIdent())
-	var key any
-	if msg.Key != "" {
-		key = msg.Key
+	if s.coalescing().anyApplies(msgs) {
+		return addEach(ctx, exec, msgs, s.Add)
+	}
+	if err := releaseDedupKeys(ctx, exec, s.tableIdent(), msgs, s.dedupCutoff(), questionMark); err != nil {
+		return err
+	}
+	return insertMany(ctx, exec, s.tableIdent(), runs, questionMark, sqliteDedup)
+}
+
+// Cancel withdraws a message that has not been claimed for delivery yet.
+func (s *SQLite) Cancel(ctx context.Context, exec txoutbox.Executor, id int64) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET status='cancelled' WHERE id=? AND status IN ('pending','retry')", s.tableIdent())
+	res, err := exec.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CancelByKey withdraws every unclaimed message with the given key.
+func (s *SQLite) CancelByKey(ctx context.Context, exec txoutbox.Executor, key string) (int64, error) {
+	query := fmt.Sprintf("UPDATE %s SET status='cancelled' WHERE key=? AND status IN ('pending','retry')", s.tableIdent())
+	res, err := exec.ExecContext(ctx, query, key)
+	if err != nil {
+		return 0, err
 	}
-	_, err = exec.ExecContext(ctx, query, msg.Topic, key, payload)
-	return err
+	return res.RowsAffected()
 }
 
 // Claim leases up to limit rows for the given worker.
@@ -75,9 +200,9 @@ func (s *SQLite) Claim(ctx context.Context, workerID string, limit int, leaseTTL
 	leaseUntil := now.Add(leaseTTL)
 	query := fmt.Sprintf(`
 WITH candidates AS (
-    SELECT id FROM %s
+    SELECT id FROM %s AS c
     WHERE status IN ('pending','retry','sending')
-      AND next_retry_at <= ?
+      AND next_retry_at <= ?%s
     ORDER BY id
     LIMIT ?
 )
@@ -85,9 +210,10 @@ UPDATE %s
 SET status = 'sending',
     claimed_by = ?,
     claimed_at = ?,
-    next_retry_at = ?
+    next_retry_at = ?,
+    lease_token = lease_token + 1
 WHERE id IN (SELECT id FROM candidates)
-RETURNING id, topic, key, payload, retry_count, created_at;`, s.tableIdent(), s.tableIdent())
+RETURNING id, topic, key, payload, retry_count, created_at, claimed_by, lease_token, headers, traceparent, tracestate, supersedes;`, s.tableIdent(), s.orderedKeysFilter(), s.tableIdent())
 
 	rows, err := s.db.QueryContext(ctx, query, now, limit, workerID, now, leaseUntil)
 	if err != nil {
@@ -98,14 +224,24 @@ RETURNING id, topic, key, payload, retry_count, created_at;`, s.tableIdent(), s.
 	var envelopes []txoutbox.Envelope
 	for rows.Next() {
 		var (
-			id         int64
-			topic      string
-			key        sql.NullString
-			payload    []byte
-			retryCount int
-			createdAt  time.Time
+			id          int64
+			topic       string
+			key         sql.NullString
+			payload     []byte
+			retryCount  int
+			createdAt   time.Time
+			claimedBy   string
+			leaseToken  int64
+			rawHeaders  []byte
+			traceParent sql.NullString
+			traceState  sql.NullString
+			supersedes  int
 		)
-		if err := rows.Scan(&id, &topic, &key, &payload, &retryCount, &createdAt); err != nil {
+		if err := rows.Scan(&id, &topic, &key, &payload, &retryCount, &createdAt, &claimedBy, &leaseToken, &rawHeaders, &traceParent, &traceState, &supersedes); err != nil {
+			return nil, err
+		}
+		headers, err := decodeHeaders(rawHeaders)
+		if err != nil {
 			return nil, err
 		}
 		envelopes = append(envelopes, txoutbox.Envelope{
@@ -115,6 +251,11 @@ RETURNING id, topic, key, payload, retry_count, created_at;`, s.tableIdent(), s.
 			Payload:    append([]byte(nil), payload...),
 			RetryCount: retryCount,
 			CreatedAt:  createdAt,
+			ClaimedBy:  claimedBy,
+			LeaseToken: leaseToken,
+			Headers:    headers,
+			Trace:      txoutbox.TraceContext{TraceParent: traceParent.String, TraceState: traceState.String},
+			Supersedes: supersedes,
 		})
 	}
 	if err := rows.Err(); err != nil {
@@ -123,38 +264,234 @@ RETURNING id, topic, key, payload, retry_count, created_at;`, s.tableIdent(), s.
 	return envelopes, nil
 }
 
-// Send marks the row successful.
-func (s *SQLite) Send(ctx context.Context, id int64, sendAt time.Time) error {
-	query := fmt.Sprintf("UPDATE %s SET status='sent', sent_at=?, claimed_by=NULL, claimed_at=NULL WHERE id=?", s.tableIdent())
-	_, err := s.db.ExecContext(ctx, query, sendAt, id)
-	return err
+// orderedKeysFilter restricts Claim candidates to the oldest unfinished message per key.
+func (s *SQLite) orderedKeysFilter() string {
+	if !s.orderedKeys {
+		return ""
+	}
+	return fmt.Sprintf(`
+      AND (c.key IS NULL OR NOT EXISTS (
+          SELECT 1 FROM %s AS p
+          WHERE p.key = c.key
+            AND p.id < c.id
+            AND p.status NOT IN ('sent','failed','cancelled','superseded')
+      ))`, s.tableIdent())
+}
+
+// Send marks the row successful if it is still held by the lease.
+func (s *SQLite) Send(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
+	query := fmt.Sprintf(`
+UPDATE %s
+SET status='sent',
+    sent_at=?,
+    last_attempt_at=?,
+    last_error=NULL,
+    claimed_by=NULL,
+    claimed_at=NULL
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	args := []any{attempt.At, attempt.At, lease.ID, lease.WorkerID, lease.Token}
+	followups := append(s.attemptHistory(lease, attempt, "sent"), s.archive().move(lease)...)
+	return acknowledge(ctx, s.db, lease, statement{query, args}, followups...)
 }
 
-// Retry schedules the row for another attempt.
-func (s *SQLite) Retry(ctx context.Context, id int64, retryCount int, nextRetry time.Time) error {
+// Retry schedules the row for another attempt if it is still held by the lease.
+func (s *SQLite) Retry(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt, nextRetry time.Time) error {
 	query := fmt.Sprintf(`
 UPDATE %s
 SET status='retry',
     retry_count=?,
     next_retry_at=?,
+    last_error=?,
+    last_attempt_at=?,
     claimed_by=NULL,
     claimed_at=NULL
-WHERE id=?`, s.tableIdent())
-	_, err := s.db.ExecContext(ctx, query, retryCount, nextRetry, id)
-	return err
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	args := []any{attempt.Number, nextRetry, attemptError(attempt.Err), attempt.At, lease.ID, lease.WorkerID, lease.Token}
+	return acknowledge(ctx, s.db, lease, statement{query, args}, s.attemptHistory(lease, attempt, "retry")...)
 }
 
-// Fail marks the row permanently failed.
-func (s *SQLite) Fail(ctx context.Context, id int64, retryCount int) error {
+// Fail marks the row permanently failed if it is still held by the lease.
+func (s *SQLite) Fail(ctx context.Context, lease txoutbox.Lease, attempt txoutbox.Attempt) error {
 	query := fmt.Sprintf(`
 UPDATE %s
 SET status='failed',
     retry_count=?,
+    last_error=?,
+    last_attempt_at=?,
     claimed_by=NULL,
     claimed_at=NULL
-WHERE id=?`, s.tableIdent())
-	_, err := s.db.ExecContext(ctx, query, retryCount, id)
-	return err
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	args := []any{attempt.Number, attemptError(attempt.Err), attempt.At, lease.ID, lease.WorkerID, lease.Token}
+	return acknowledge(ctx, s.db, lease, statement{query, args}, s.attemptHistory(lease, attempt, "failed")...)
+}
+
+// ExtendLease pushes the lease expiry to ttl from now if the row is still held by the lease.
+func (s *SQLite) ExtendLease(ctx context.Context, lease txoutbox.Lease, ttl time.Duration) error {
+	query := fmt.Sprintf(`
+UPDATE %s
+SET next_retry_at=?
+WHERE id=? AND claimed_by=? AND lease_token=?`, s.tableIdent())
+	res, err := s.db.ExecContext(ctx, query, s.now().UTC().Add(ttl), lease.ID, lease.WorkerID, lease.Token)
+	return checkLease(res, err, lease)
+}
+
+// Release hands claimed rows back without counting an attempt, making them claimable again at once.
+// Large batches are split so no statement binds more than maxBindParams values.
+func (s *SQLite) Release(ctx context.Context, leases []txoutbox.Lease) (int64, error) {
+	return releaseInChunks(leases, func(chunk []txoutbox.Lease) (int64, error) {
+		return s.release(ctx, chunk)
+	})
+}
+
+func (s *SQLite) release(ctx context.Context, leases []txoutbox.Lease) (int64, error) {
+	match, args := leaseMatch(leases, []any{s.now().UTC()}, questionMark)
+	query := fmt.Sprintf(`
+UPDATE %s
+SET status = CASE WHEN retry_count > 0 THEN 'retry' ELSE 'pending' END,
+    next_retry_at = ?,
+    claimed_by = NULL,
+    claimed_at = NULL
+WHERE %s`, s.tableIdent(), match)
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SendMany marks every message still held by its lease as sent in one transaction, returning the leases that were
+// lost.
+func (s *SQLite) SendMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, sendSet, func(held []txoutbox.Ack) []statement {
+		return append(bulkHistory(s.attemptsIdent(), held, "sent", questionMark), s.archive().moveMany(held)...)
+	})
+}
+
+// RetryMany schedules every message still held by its lease for another attempt in one transaction, returning the
+// leases that were lost.
+func (s *SQLite) RetryMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, retrySet, func(held []txoutbox.Ack) []statement {
+		return bulkHistory(s.attemptsIdent(), held, "retry", questionMark)
+	})
+}
+
+// FailMany marks every message still held by its lease permanently failed in one transaction, returning the leases
+// that were lost.
+func (s *SQLite) FailMany(ctx context.Context, acks []txoutbox.Ack) ([]txoutbox.Lease, error) {
+	return s.bulk().apply(ctx, acks, failSet, func(held []txoutbox.Ack) []statement {
+		return bulkHistory(s.attemptsIdent(), held, "failed", questionMark)
+	})
+}
+
+func (s *SQLite) bulk() bulkAcks {
+	return bulkAcks{
+		db:          s.db,
+		table:       s.tableIdent(),
+		placeholder: questionMark,
+		cast:        keepMarker,
+		lock:        "",
+		inIDs:       inList,
+	}
+}
+
+// attemptsIdent returns the quoted attempts table, or an empty string when attempt history is off.
+func (s *SQLite) attemptsIdent() string {
+	if s.attemptsTable == "" {
+		return ""
+	}
+	return sqlutil.QuoteIdentifier(s.attemptsTable, `"`)
+}
+
+// attemptHistory returns the insert recording an attempt, or nothing when no attempts table is configured.
+func (s *SQLite) attemptHistory(lease txoutbox.Lease, attempt txoutbox.Attempt, status string) []statement {
+	if s.attemptsTable == "" {
+		return nil
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sqlutil.QuoteIdentifier(s.attemptsTable, `"`), historyColumns, placeholders(7))
+	return []statement{{query, historyValues(lease, attempt, status)}}
+}
+
+// ListFailed returns permanently failed messages matching filter, ordered by ID.
+func (s *SQLite) ListFailed(ctx context.Context, filter txoutbox.DeadLetterFilter, page txoutbox.Page) ([]txoutbox.DeadLetter, error) {
+	return s.deadLetters().list(ctx, filter, page)
+}
+
+// GetFailed returns a single permanently failed message, or txoutbox.ErrNotFound.
+func (s *SQLite) GetFailed(ctx context.Context, id int64) (txoutbox.DeadLetter, error) {
+	return s.deadLetters().get(ctx, id)
+}
+
+// RequeueFailed makes matching failed messages claimable again with retry_count reset to zero.
+func (s *SQLite) RequeueFailed(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	return s.deadLetters().requeue(ctx, filter)
+}
+
+// DiscardFailed deletes matching failed messages along with their attempt history.
+func (s *SQLite) DiscardFailed(ctx context.Context, filter txoutbox.DeadLetterFilter) (int64, error) {
+	return s.deadLetters().discard(ctx, filter)
+}
+
+func (s *SQLite) deadLetters() deadLetters {
+	return deadLetters{
+		db:          s.db,
+		table:       s.tableIdent(),
+		keyColumn:   "key",
+		attempts:    s.attemptsIdent(),
+		now:         s.now,
+		placeholder: questionMark,
+		contains:    func(marker string) string { return "instr(last_error, " + marker + ") > 0" },
+	}
+}
+
+// PurgeSent deletes up to limit sent messages delivered before the cutoff, along with their attempt history.
+func (s *SQLite) PurgeSent(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.purge(ctx, s.tableIdent(), "status = 'sent' AND sent_at < ?", before, limit)
+}
+
+// PurgeFailed deletes up to limit failed messages whose final attempt happened before the cutoff.
+// Rows failed before last_attempt_at was tracked fall back to created_at.
+func (s *SQLite) PurgeFailed(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.purge(ctx, s.tableIdent(), "status = 'failed' AND COALESCE(last_attempt_at, created_at) < ?", before, limit)
+}
+
+func (s *SQLite) purge(ctx context.Context, table, cond string, before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		return 0, fmt.Errorf("txoutbox: batch size must be positive")
+	}
+	var attempts string
+	if s.attemptsTable != "" {
+		attempts = sqlutil.QuoteIdentifier(s.attemptsTable, `"`)
+	}
+	query := fmt.Sprintf("SELECT id FROM %s WHERE %s ORDER BY id LIMIT ?", table, cond)
+	return purgeRows(ctx, s.db, table, attempts, query, []any{before.UTC(), limit}, placeholders)
+}
+
+// ListArchived returns messages moved to the archive table, ordered by ID.
+func (s *SQLite) ListArchived(ctx context.Context, filter txoutbox.ArchiveFilter, page txoutbox.Page) ([]txoutbox.ArchivedMessage, error) {
+	return s.archive().list(ctx, filter, page)
+}
+
+// PurgeArchived deletes up to limit archived messages delivered before the cutoff, along with their attempt history.
+func (s *SQLite) PurgeArchived(ctx context.Context, before time.Time, limit int) (int64, error) {
+	table := s.archive().table
+	if table == "" {
+		return 0, txoutbox.ErrNoArchive
+	}
+	return s.purge(ctx, table, "sent_at < ?", before, limit)
+}
+
+func (s *SQLite) archive() archive {
+	var table string
+	if s.archiveTable != "" {
+		table = sqlutil.QuoteIdentifier(s.archiveTable, `"`)
+	}
+	return archive{
+		db:          s.db,
+		table:       table,
+		source:      s.tableIdent(),
+		keyColumn:   `"key"`,
+		placeholder: questionMark,
+	}
 }
 
 func (s *SQLite) tableIdent() string {
@@ -2,6 +2,8 @@ package stores_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -22,7 +24,8 @@ func TestSQLiteStoreLifecycle(t *testing.T) {
 		t.Fatalf("begin tx: %v", err)
 	}
 	msg := txoutbox.Message{Topic: "sqlite.event", Key: "id-1", Body: map[string]any{"foo": "bar"}}
-	if err := store.Add(ctx, tx, msg); err != nil {
+	id, err := store.Add(ctx, tx, msg)
+	if err != nil {
 		t.Fatalf("Add error: %v", err)
 	}
 	if err := tx.Commit(); err != nil {
@@ -36,6 +39,9 @@ func TestSQLiteStoreLifecycle(t *testing.T) {
 	if len(envs) != 1 {
 		t.Fatalf("expected 1 envelope, got %d", len(envs))
 	}
+	if envs[0].ID != id {
+		t.Fatalf("envelope ID = %d, want %d returned by Add", envs[0].ID, id)
+	}
 
 	var payload map[string]string
 	if err := envs[0].Decode(&payload); err != nil {
@@ -45,10 +51,21 @@ func TestSQLiteStoreLifecycle(t *testing.T) {
 		t.Fatalf("payload mismatch: %+v", payload)
 	}
 
-	if err := store.Retry(ctx, envs[0].ID, envs[0].RetryCount+1, time.Now().Add(time.Minute)); err != nil {
+	if err := store.Retry(ctx, envs[0].Lease(), txoutbox.Attempt{Number: envs[0].RetryCount + 1, At: time.Now().UTC()}, time.Now().Add(-time.Minute)); err != nil {
 		t.Fatalf("Retry error: %v", err)
 	}
-	if err := store.Fail(ctx, envs[0].ID, envs[0].RetryCount+2); err != nil {
+
+	reclaimed, err := store.Claim(ctx, "worker-sqlite", 5, time.Minute)
+	if err != nil {
+		t.Fatalf("reclaim error: %v", err)
+	}
+	if len(reclaimed) != 1 {
+		t.Fatalf("expected 1 envelope on reclaim, got %d", len(reclaimed))
+	}
+	if reclaimed[0].LeaseToken <= envs[0].LeaseToken {
+		t.Fatalf("lease token = %d, want > %d", reclaimed[0].LeaseToken, envs[0].LeaseToken)
+	}
+	if err := store.Fail(ctx, reclaimed[0].Lease(), txoutbox.Attempt{Number: reclaimed[0].RetryCount + 1, At: time.Now().UTC()}); err != nil {
 		t.Fatalf("Fail error: %v", err)
 	}
 }
@@ -67,3 +84,1148 @@ func TestSQLiteStoreClaimEmpty(t *testing.T) {
 		t.Fatalf("expected 0 envelopes, got %d", len(envs))
 	}
 }
+
+func TestSQLiteStoreRejectsStaleLease(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db, stores.WithSQLiteNow(func() time.Time { return now }))
+
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "sqlite.event", Body: map[string]any{"foo": "bar"}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	stale, err := store.Claim(ctx, "worker-stale", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(stale) != 1 {
+		t.Fatalf("expected 1 envelope, got %d", len(stale))
+	}
+
+	now = now.Add(2 * time.Minute)
+	fresh, err := store.Claim(ctx, "worker-fresh", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("reclaim error: %v", err)
+	}
+	if len(fresh) != 1 {
+		t.Fatalf("expected 1 envelope after lease expiry, got %d", len(fresh))
+	}
+
+	if err := store.Send(ctx, stale[0].Lease(), txoutbox.Attempt{Number: 1, At: now}); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("stale Send error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+	if err := store.Retry(ctx, stale[0].Lease(), txoutbox.Attempt{Number: 1, At: now}, now); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("stale Retry error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+	if err := store.Send(ctx, fresh[0].Lease(), txoutbox.Attempt{Number: 1, At: now}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	var status string
+	if err := db.QueryRowContext(ctx, "SELECT status FROM txoutbox WHERE id=?", fresh[0].ID).Scan(&status); err != nil {
+		t.Fatalf("select status: %v", err)
+	}
+	if status != "sent" {
+		t.Fatalf("final status = %s, want sent", status)
+	}
+}
+
+func TestSQLiteStoreOrderedKeys(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteOrderedKeys(true),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	for _, msg := range []txoutbox.Message{
+		{Topic: "order.created", Key: "order-1", Body: map[string]any{"seq": 1}},
+		{Topic: "order.paid", Key: "order-1", Body: map[string]any{"seq": 2}},
+		{Topic: "order.created", Key: "order-2", Body: map[string]any{"seq": 3}},
+		{Topic: "audit", Body: map[string]any{"seq": 4}},
+	} {
+		if _, err := store.Add(ctx, db, msg); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	first, err := store.Claim(ctx, "worker-a", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if got := envelopeTopics(first); len(got) != 3 || got[0] != "order.created" || got[1] != "order.created" || got[2] != "audit" {
+		t.Fatalf("first claim topics = %v, want [order.created order.created audit]", got)
+	}
+
+	blocked, err := store.Claim(ctx, "worker-b", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(blocked) != 0 {
+		t.Fatalf("expected no envelopes while order-1 is in flight, got %v", envelopeTopics(blocked))
+	}
+
+	if err := store.Retry(ctx, first[0].Lease(), txoutbox.Attempt{Number: 1, At: now}, now.Add(-time.Second)); err != nil {
+		t.Fatalf("Retry error: %v", err)
+	}
+	retried, err := store.Claim(ctx, "worker-b", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(retried) != 1 || retried[0].ID != first[0].ID {
+		t.Fatalf("expected retried id=%d to be claimed before later messages, got %v", first[0].ID, envelopeTopics(retried))
+	}
+
+	if err := store.Send(ctx, retried[0].Lease(), txoutbox.Attempt{Number: 1, At: now}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	next, err := store.Claim(ctx, "worker-b", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if got := envelopeTopics(next); len(got) != 1 || got[0] != "order.paid" {
+		t.Fatalf("claim after send topics = %v, want [order.paid]", got)
+	}
+}
+
+func envelopeTopics(envs []txoutbox.Envelope) []string {
+	topics := make([]string, len(envs))
+	for i, env := range envs {
+		topics[i] = env.Topic
+	}
+	return topics
+}
+
+func TestSQLiteStoreDeliverAt(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db, stores.WithSQLiteNow(func() time.Time { return now }))
+	if _, err := store.Add(ctx, db, txoutbox.Message{
+		Topic:     "reminder",
+		Body:      map[string]any{"id": 1},
+		DeliverAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 0 {
+		t.Fatalf("expected scheduled message to be hidden, got %d envelopes", len(envs))
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	envs, err = store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 1 {
+		t.Fatalf("expected scheduled message once due, got %d envelopes", len(envs))
+	}
+}
+
+func TestSQLiteStoreCancel(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db, stores.WithSQLiteNow(func() time.Time { return now }))
+	for _, msg := range []txoutbox.Message{
+		{Topic: "reminder", Key: "order-1", Body: map[string]any{"n": 1}, DeliverAt: now.Add(time.Hour)},
+		{Topic: "timeout", Key: "order-1", Body: map[string]any{"n": 2}, DeliverAt: now.Add(time.Hour)},
+		{Topic: "reminder", Key: "order-2", Body: map[string]any{"n": 3}, DeliverAt: now.Add(time.Hour)},
+	} {
+		if _, err := store.Add(ctx, db, msg); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	n, err := store.CancelByKey(ctx, db, "order-1")
+	if err != nil {
+		t.Fatalf("CancelByKey error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("CancelByKey cancelled %d rows, want 2", n)
+	}
+
+	var id int64
+	if err := db.QueryRowContext(ctx, "SELECT id FROM txoutbox WHERE key = 'order-2'").Scan(&id); err != nil {
+		t.Fatalf("select id: %v", err)
+	}
+	ok, err := store.Cancel(ctx, db, id)
+	if err != nil {
+		t.Fatalf("Cancel error: %v", err)
+	}
+	if !ok {
+		t.Fatal("Cancel reported no row withdrawn")
+	}
+	if ok, err := store.Cancel(ctx, db, id); err != nil || ok {
+		t.Fatalf("second Cancel = %v, %v; want false, nil", ok, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 0 {
+		t.Fatalf("expected cancelled messages to stay unclaimed, got %d envelopes", len(envs))
+	}
+}
+
+func TestSQLiteStoreHeaders(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db)
+	headers := map[string]string{"correlation-id": "abc-123", "tenant-id": "acme"}
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "with.headers", Body: map[string]any{"n": 1}, Headers: headers}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "without.headers", Body: map[string]any{"n": 2}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 2 {
+		t.Fatalf("expected 2 envelopes, got %d", len(envs))
+	}
+	if got := envs[0].Headers; len(got) != 2 || got["correlation-id"] != "abc-123" || got["tenant-id"] != "acme" {
+		t.Fatalf("headers = %v, want %v", got, headers)
+	}
+	if envs[1].Headers != nil {
+		t.Fatalf("headers = %v, want nil", envs[1].Headers)
+	}
+}
+
+func TestSQLiteStoreCapturesTraceContext(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	tc := txoutbox.TraceContext{
+		TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		TraceState:  "vendor=value",
+	}
+	store := stores.NewSQLite(db, stores.WithSQLitePropagator(staticPropagator{tc: tc}))
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "traced", Body: map[string]any{"n": 1}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 1 {
+		t.Fatalf("expected 1 envelope, got %d", len(envs))
+	}
+	if envs[0].Trace != tc {
+		t.Fatalf("trace context = %+v, want %+v", envs[0].Trace, tc)
+	}
+}
+
+// staticPropagator injects a fixed trace context regardless of the caller's context.
+type staticPropagator struct {
+	tc txoutbox.TraceContext
+}
+
+func (p staticPropagator) Inject(context.Context) txoutbox.TraceContext {
+	return p.tc
+}
+
+func (p staticPropagator) Extract(ctx context.Context, _ txoutbox.TraceContext) context.Context {
+	return ctx
+}
+
+func TestSQLiteStoreAttemptHistory(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteAttemptsTable("txoutbox_attempts"),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "history", Body: map[string]any{"n": 1}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	first, err := store.Claim(ctx, "worker-a", 1, time.Minute)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Claim = %d envelopes, %v; want 1, nil", len(first), err)
+	}
+	attempt := txoutbox.Attempt{Number: 1, At: now, Duration: 1500 * time.Millisecond, Err: errors.New("connection reset")}
+	if err := store.Retry(ctx, first[0].Lease(), attempt, now.Add(-time.Second)); err != nil {
+		t.Fatalf("Retry error: %v", err)
+	}
+
+	var lastError *string
+	if err := db.QueryRowContext(ctx, "SELECT last_error FROM txoutbox WHERE id=?", first[0].ID).Scan(&lastError); err != nil {
+		t.Fatalf("select last_error: %v", err)
+	}
+	if lastError == nil || *lastError != "connection reset" {
+		t.Fatalf("last_error = %v, want connection reset", lastError)
+	}
+
+	second, err := store.Claim(ctx, "worker-b", 1, time.Minute)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("Claim = %d envelopes, %v; want 1, nil", len(second), err)
+	}
+	if err := store.Send(ctx, second[0].Lease(), txoutbox.Attempt{Number: 2, At: now, Duration: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT last_error FROM txoutbox WHERE id=?", first[0].ID).Scan(&lastError); err != nil {
+		t.Fatalf("select last_error: %v", err)
+	}
+	if lastError != nil {
+		t.Fatalf("last_error = %q after send, want NULL", *lastError)
+	}
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT attempt, worker_id, status, error, duration_ms FROM txoutbox_attempts WHERE message_id=? ORDER BY attempt",
+		first[0].ID,
+	)
+	if err != nil {
+		t.Fatalf("select attempts: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	type row struct {
+		attempt    int
+		workerID   string
+		status     string
+		err        *string
+		durationMS int64
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.attempt, &r.workerID, &r.status, &r.err, &r.durationMS); err != nil {
+			t.Fatalf("scan attempt: %v", err)
+		}
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("iterate attempts: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 attempt rows, got %d", len(got))
+	}
+	if r := got[0]; r.attempt != 1 || r.workerID != "worker-a" || r.status != "retry" || r.err == nil || *r.err != "connection reset" || r.durationMS != 1500 {
+		t.Fatalf("first attempt = %+v", r)
+	}
+	if r := got[1]; r.attempt != 2 || r.workerID != "worker-b" || r.status != "sent" || r.err != nil || r.durationMS != 20 {
+		t.Fatalf("second attempt = %+v", r)
+	}
+}
+
+func TestSQLiteStoreDeadLetters(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteAttemptsTable("txoutbox_attempts"),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	for i, msg := range []txoutbox.Message{
+		{Topic: "order.created", Key: "order-1", Body: map[string]any{"n": 1}},
+		{Topic: "order.created", Key: "order-2", Body: map[string]any{"n": 2}},
+		{Topic: "invoice.sent", Key: "invoice-1", Body: map[string]any{"n": 3}},
+		{Topic: "order.created", Key: "order-3", Body: map[string]any{"n": 4}},
+	} {
+		if _, err := store.Add(ctx, db, msg); err != nil {
+			t.Fatalf("Add %d error: %v", i, err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil || len(envs) != 4 {
+		t.Fatalf("Claim = %d envelopes, %v; want 4, nil", len(envs), err)
+	}
+	failures := []error{errors.New("http 500: upstream down"), errors.New("http 400: bad payload"), errors.New("http 500: upstream down")}
+	for i, failure := range failures {
+		attempt := txoutbox.Attempt{Number: 3, At: now.Add(time.Duration(i) * time.Minute), Err: failure}
+		if err := store.Fail(ctx, envs[i].Lease(), attempt); err != nil {
+			t.Fatalf("Fail error: %v", err)
+		}
+	}
+	if err := store.Send(ctx, envs[3].Lease(), txoutbox.Attempt{Number: 1, At: now}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	all, err := store.ListFailed(ctx, txoutbox.DeadLetterFilter{}, txoutbox.Page{})
+	if err != nil {
+		t.Fatalf("ListFailed error: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 failed messages, got %d", len(all))
+	}
+
+	firstPage, err := store.ListFailed(ctx, txoutbox.DeadLetterFilter{Topic: "order.created"}, txoutbox.Page{Limit: 1})
+	if err != nil || len(firstPage) != 1 || firstPage[0].ID != envs[0].ID {
+		t.Fatalf("first page = %v, %v; want id=%d", firstPage, err, envs[0].ID)
+	}
+	secondPage, err := store.ListFailed(ctx, txoutbox.DeadLetterFilter{Topic: "order.created"}, txoutbox.Page{AfterID: firstPage[0].ID, Limit: 1})
+	if err != nil || len(secondPage) != 1 || secondPage[0].ID != envs[1].ID {
+		t.Fatalf("second page = %v, %v; want id=%d", secondPage, err, envs[1].ID)
+	}
+
+	upstream, err := store.ListFailed(ctx, txoutbox.DeadLetterFilter{ErrorContains: "upstream", FailedAfter: now.Add(time.Minute)}, txoutbox.Page{})
+	if err != nil || len(upstream) != 1 || upstream[0].ID != envs[2].ID {
+		t.Fatalf("filtered list = %v, %v; want id=%d", upstream, err, envs[2].ID)
+	}
+
+	letter, err := store.GetFailed(ctx, envs[1].ID)
+	if err != nil {
+		t.Fatalf("GetFailed error: %v", err)
+	}
+	if letter.LastError != "http 400: bad payload" || letter.RetryCount != 3 || letter.Key == nil || *letter.Key != "order-2" {
+		t.Fatalf("GetFailed = %+v", letter)
+	}
+	if _, err := store.GetFailed(ctx, envs[3].ID); !errors.Is(err, txoutbox.ErrNotFound) {
+		t.Fatalf("GetFailed of sent message error = %v, want %v", err, txoutbox.ErrNotFound)
+	}
+
+	if _, err := store.RequeueFailed(ctx, txoutbox.DeadLetterFilter{}); !errors.Is(err, txoutbox.ErrEmptyFilter) {
+		t.Fatalf("RequeueFailed with an empty filter error = %v, want %v", err, txoutbox.ErrEmptyFilter)
+	}
+	if _, err := store.DiscardFailed(ctx, txoutbox.DeadLetterFilter{}); !errors.Is(err, txoutbox.ErrEmptyFilter) {
+		t.Fatalf("DiscardFailed with an empty filter error = %v, want %v", err, txoutbox.ErrEmptyFilter)
+	}
+
+	requeued, err := store.RequeueFailed(ctx, txoutbox.DeadLetterFilter{ErrorContains: "upstream"})
+	if err != nil || requeued != 2 {
+		t.Fatalf("RequeueFailed = %d, %v; want 2, nil", requeued, err)
+	}
+	replay, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(replay) != 2 || replay[0].ID != envs[0].ID || replay[1].ID != envs[2].ID || replay[0].RetryCount != 0 {
+		t.Fatalf("replayed envelopes = %+v", replay)
+	}
+
+	discarded, err := store.DiscardFailed(ctx, txoutbox.DeadLetterFilter{IDs: []int64{envs[1].ID, envs[3].ID}})
+	if err != nil || discarded != 1 {
+		t.Fatalf("DiscardFailed = %d, %v; want 1, nil", discarded, err)
+	}
+	var remaining int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&remaining); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if remaining != 3 {
+		t.Fatalf("remaining rows = %d, want 3", remaining)
+	}
+	var discardedAttempts, keptAttempts int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox_attempts WHERE message_id = ?", envs[1].ID).Scan(&discardedAttempts); err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox_attempts WHERE message_id = ?", envs[3].ID).Scan(&keptAttempts); err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+	if discardedAttempts != 0 || keptAttempts != 1 {
+		t.Fatalf("attempts of discarded/kept rows = %d/%d, want 0/1", discardedAttempts, keptAttempts)
+	}
+}
+
+func TestSQLiteStorePurge(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteAttemptsTable("txoutbox_attempts"),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	for i := 0; i < 5; i++ {
+		if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "purge", Body: map[string]any{"n": i}}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil || len(envs) != 5 {
+		t.Fatalf("Claim = %d envelopes, %v; want 5, nil", len(envs), err)
+	}
+	old := now.Add(-48 * time.Hour)
+	for _, env := range envs[:3] {
+		if err := store.Send(ctx, env.Lease(), txoutbox.Attempt{Number: 1, At: old}); err != nil {
+			t.Fatalf("Send error: %v", err)
+		}
+	}
+	if err := store.Send(ctx, envs[3].Lease(), txoutbox.Attempt{Number: 1, At: now}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if err := store.Fail(ctx, envs[4].Lease(), txoutbox.Attempt{Number: 1, At: old, Err: errors.New("boom")}); err != nil {
+		t.Fatalf("Fail error: %v", err)
+	}
+
+	cutoff := now.Add(-24 * time.Hour)
+	n, err := store.PurgeSent(ctx, cutoff, 2)
+	if err != nil || n != 2 {
+		t.Fatalf("PurgeSent = %d, %v; want 2, nil", n, err)
+	}
+	n, err = store.PurgeSent(ctx, cutoff, 2)
+	if err != nil || n != 1 {
+		t.Fatalf("second PurgeSent = %d, %v; want 1, nil", n, err)
+	}
+	n, err = store.PurgeFailed(ctx, cutoff, 10)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeFailed = %d, %v; want 1, nil", n, err)
+	}
+
+	var remaining, history int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&remaining); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("remaining rows = %d, want 1", remaining)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox_attempts").Scan(&history); err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+	if history != 1 {
+		t.Fatalf("remaining attempt rows = %d, want 1", history)
+	}
+}
+
+func TestSQLiteStoreArchive(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteArchiveTable("txoutbox_archive"),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	for _, msg := range []txoutbox.Message{
+		{Topic: "order.created", Key: "order-1", Body: map[string]any{"n": 1}, Headers: map[string]string{"tenant-id": "acme"}},
+		{Topic: "order.created", Key: "order-2", Body: map[string]any{"n": 2}},
+		{Topic: "invoice.sent", Key: "order-1", Body: map[string]any{"n": 3}},
+	} {
+		if _, err := store.Add(ctx, db, msg); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker-a", 10, time.Minute)
+	if err != nil || len(envs) != 3 {
+		t.Fatalf("Claim = %d envelopes, %v; want 3, nil", len(envs), err)
+	}
+	for i, env := range envs[:2] {
+		if err := store.Send(ctx, env.Lease(), txoutbox.Attempt{Number: 1, At: now.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatalf("Send error: %v", err)
+		}
+	}
+	if err := store.Retry(ctx, envs[2].Lease(), txoutbox.Attempt{Number: 1, At: now, Err: errors.New("boom")}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("Retry error: %v", err)
+	}
+
+	var remaining int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&remaining); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("outbox rows = %d, want only the retried message", remaining)
+	}
+
+	archived, err := store.ListArchived(ctx, txoutbox.ArchiveFilter{Key: "order-1"}, txoutbox.Page{})
+	if err != nil {
+		t.Fatalf("ListArchived error: %v", err)
+	}
+	if len(archived) != 1 {
+		t.Fatalf("expected 1 archived message, got %d", len(archived))
+	}
+	got := archived[0]
+	if got.ID != envs[0].ID || got.Topic != "order.created" || got.ClaimedBy != "worker-a" || got.Headers["tenant-id"] != "acme" {
+		t.Fatalf("archived message = %+v", got)
+	}
+	if !got.SentAt.Equal(now) {
+		t.Fatalf("sent_at = %s, want %s", got.SentAt, now)
+	}
+
+	late, err := store.ListArchived(ctx, txoutbox.ArchiveFilter{Topic: "order.created", SentAfter: now.Add(30 * time.Minute)}, txoutbox.Page{})
+	if err != nil || len(late) != 1 || late[0].ID != envs[1].ID {
+		t.Fatalf("ListArchived by time = %+v, %v; want id=%d", late, err, envs[1].ID)
+	}
+
+	if err := store.Send(ctx, envs[0].Lease(), txoutbox.Attempt{Number: 1, At: now}); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("Send of archived message error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+}
+
+func TestSQLiteStoreRelease(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db, stores.WithSQLiteNow(func() time.Time { return now }))
+	for i := 0; i < 3; i++ {
+		if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "release", Body: map[string]any{"n": i}}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker-a", 3, time.Hour)
+	if err != nil || len(envs) != 3 {
+		t.Fatalf("Claim = %d envelopes, %v; want 3, nil", len(envs), err)
+	}
+	stale := envs[2].Lease()
+	stale.Token--
+
+	n, err := store.Release(ctx, []txoutbox.Lease{envs[0].Lease(), envs[1].Lease(), stale})
+	if err != nil || n != 2 {
+		t.Fatalf("Release = %d, %v; want 2, nil", n, err)
+	}
+
+	reclaimed, err := store.Claim(ctx, "worker-b", 10, time.Hour)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(reclaimed) != 2 || reclaimed[0].ID != envs[0].ID || reclaimed[1].ID != envs[1].ID {
+		t.Fatalf("reclaimed = %v, want ids %d and %d", reclaimed, envs[0].ID, envs[1].ID)
+	}
+	if reclaimed[0].RetryCount != 0 {
+		t.Fatalf("retry_count = %d after release, want 0", reclaimed[0].RetryCount)
+	}
+}
+
+func TestSQLiteStoreExtendLease(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db, stores.WithSQLiteNow(func() time.Time { return now }))
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "upload", Body: map[string]any{"file": "a.bin"}}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker-a", 1, time.Minute)
+	if err != nil || len(envs) != 1 {
+		t.Fatalf("Claim = %d envelopes, %v; want 1, nil", len(envs), err)
+	}
+	now = now.Add(50 * time.Second)
+	if err := store.ExtendLease(ctx, envs[0].Lease(), time.Minute); err != nil {
+		t.Fatalf("ExtendLease error: %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	stolen, err := store.Claim(ctx, "worker-b", 1, time.Minute)
+	if err != nil || len(stolen) != 0 {
+		t.Fatalf("Claim of extended lease = %d envelopes, %v; want 0, nil", len(stolen), err)
+	}
+
+	now = now.Add(time.Minute)
+	reclaimed, err := store.Claim(ctx, "worker-b", 1, time.Minute)
+	if err != nil || len(reclaimed) != 1 {
+		t.Fatalf("Claim after expiry = %d envelopes, %v; want 1, nil", len(reclaimed), err)
+	}
+	if err := store.ExtendLease(ctx, envs[0].Lease(), time.Minute); !errors.Is(err, txoutbox.ErrLeaseLost) {
+		t.Fatalf("ExtendLease of re-claimed row error = %v, want %v", err, txoutbox.ErrLeaseLost)
+	}
+	if err := store.ExtendLease(ctx, reclaimed[0].Lease(), time.Minute); err != nil {
+		t.Fatalf("ExtendLease by new holder error: %v", err)
+	}
+}
+
+func TestSQLiteStoreBulkAcknowledgements(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteAttemptsTable("txoutbox_attempts"),
+		stores.WithSQLiteArchiveTable("txoutbox_archive"),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	for i := 0; i < 5; i++ {
+		if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "bulk", Body: map[string]any{"n": i}}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker-a", 5, time.Minute)
+	if err != nil || len(envs) != 5 {
+		t.Fatalf("Claim = %d envelopes, %v; want 5, nil", len(envs), err)
+	}
+	ack := func(env txoutbox.Envelope, err error) txoutbox.Ack {
+		return txoutbox.Ack{Lease: env.Lease(), Attempt: txoutbox.Attempt{Number: 1, At: now, Err: err}, NextRetry: now.Add(time.Hour)}
+	}
+	stale := ack(envs[1], nil)
+	stale.Lease.Token--
+
+	lost, err := store.SendMany(ctx, []txoutbox.Ack{ack(envs[0], nil), stale})
+	if err != nil || len(lost) != 1 || lost[0] != stale.Lease {
+		t.Fatalf("SendMany = %v, %v; want the stale lease lost", lost, err)
+	}
+	if _, err := store.RetryMany(ctx, []txoutbox.Ack{ack(envs[1], errors.New("timeout")), ack(envs[2], errors.New("reset"))}); err != nil {
+		t.Fatalf("RetryMany error: %v", err)
+	}
+	if _, err := store.FailMany(ctx, []txoutbox.Ack{ack(envs[3], errors.New("rejected"))}); err != nil {
+		t.Fatalf("FailMany error: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, status, retry_count, last_error FROM txoutbox ORDER BY id")
+	if err != nil {
+		t.Fatalf("select rows: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+	got := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id         int64
+			status     string
+			retryCount int
+			lastError  *string
+		)
+		if err := rows.Scan(&id, &status, &retryCount, &lastError); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		got[id] = fmt.Sprintf("%s/%d", status, retryCount)
+		if lastError != nil {
+			got[id] += "/" + *lastError
+		}
+	}
+	want := map[int64]string{
+		envs[1].ID: "retry/1/timeout",
+		envs[2].ID: "retry/1/reset",
+		envs[3].ID: "failed/1/rejected",
+		envs[4].ID: "sending/0",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v, want %v (sent row archived)", got, want)
+	}
+
+	archived, err := store.ListArchived(ctx, txoutbox.ArchiveFilter{}, txoutbox.Page{})
+	if err != nil || len(archived) != 1 || archived[0].ID != envs[0].ID || archived[0].ClaimedBy != "worker-a" {
+		t.Fatalf("ListArchived = %+v, %v; want id=%d claimed by worker-a", archived, err, envs[0].ID)
+	}
+	var attempts int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox_attempts").Scan(&attempts); err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+	if attempts != 4 {
+		t.Fatalf("attempt rows = %d, want 4", attempts)
+	}
+}
+
+func TestSQLiteStoreAddMany(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db)
+	msgs := []txoutbox.Message{
+		{Topic: "bulk.1", Key: "k1", Body: map[string]any{"n": 1}},
+		{Topic: "bulk.2", Body: map[string]any{"n": 2}, Headers: map[string]string{"tenant-id": "acme"}},
+		{Topic: "bulk.3", Body: map[string]any{"n": 3}},
+	}
+	if err := store.AddMany(ctx, db, msgs); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != len(msgs) {
+		t.Fatalf("expected %d envelopes, got %d", len(msgs), len(envs))
+	}
+	for i, env := range envs {
+		if env.Topic != msgs[i].Topic {
+			t.Fatalf("envelope %d topic = %s, want %s", i, env.Topic, msgs[i].Topic)
+		}
+	}
+	if envs[0].Key == nil || *envs[0].Key != "k1" {
+		t.Fatalf("key = %v, want k1", envs[0].Key)
+	}
+	if envs[1].Headers["tenant-id"] != "acme" {
+		t.Fatalf("headers = %v", envs[1].Headers)
+	}
+
+	invalid := []txoutbox.Message{
+		{Topic: "bulk.ok", Body: map[string]any{"n": 4}},
+		{Topic: "bulk.bad", Body: make(chan int)},
+	}
+	if err := store.AddMany(ctx, db, invalid); err == nil {
+		t.Fatal("expected AddMany to reject an unmarshalable body")
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&count); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if count != len(msgs) {
+		t.Fatalf("rows = %d, want %d", count, len(msgs))
+	}
+}
+
+func TestSQLiteStoreDedupKey(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	msg := txoutbox.Message{Topic: "dedup", Body: map[string]any{"n": 1}, DedupKey: "req-1"}
+	if _, err := store.Add(ctx, tx, msg); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if _, err := store.Add(ctx, tx, msg); !errors.Is(err, txoutbox.ErrDuplicate) {
+		t.Fatalf("Add duplicate error = %v, want ErrDuplicate", err)
+	}
+	if _, err := store.Add(ctx, tx, txoutbox.Message{Topic: "dedup", Body: map[string]any{"n": 2}, DedupKey: "req-2"}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	batch := []txoutbox.Message{
+		{Topic: "dedup", Body: map[string]any{"n": 3}, DedupKey: "req-2"},
+		{Topic: "dedup", Body: map[string]any{"n": 4}, DedupKey: "req-3"},
+		{Topic: "dedup", Body: map[string]any{"n": 5}},
+	}
+	if err := store.AddMany(ctx, db, batch); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox").Scan(&count); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if count != 4 {
+		t.Fatalf("rows = %d, want 4", count)
+	}
+
+	windowed := stores.NewSQLite(db, stores.WithSQLiteDedupWindow(time.Hour))
+	if _, err := windowed.Add(ctx, db, msg); !errors.Is(err, txoutbox.ErrDuplicate) {
+		t.Fatalf("Add duplicate within window error = %v, want ErrDuplicate", err)
+	}
+	// Two hours later the key is free again.
+	later := stores.NewSQLite(db,
+		stores.WithSQLiteDedupWindow(time.Hour),
+		stores.WithSQLiteNow(func() time.Time { return time.Now().Add(2 * time.Hour) }),
+	)
+	if _, err := later.Add(ctx, db, msg); err != nil {
+		t.Fatalf("Add after window error: %v", err)
+	}
+}
+
+func TestSQLiteStoreCoalescedTopics(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db, stores.WithSQLiteCoalescedTopics("entity.state"))
+	add := func(msg txoutbox.Message) int64 {
+		t.Helper()
+		id, err := store.Add(ctx, db, msg)
+		if err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+		return id
+	}
+	first := add(txoutbox.Message{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": 1}})
+	add(txoutbox.Message{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": 2}})
+	other := add(txoutbox.Message{Topic: "entity.state", Key: "user-2", Body: map[string]any{"v": 1}})
+	plain := add(txoutbox.Message{Topic: "entity.audit", Key: "user-1", Body: map[string]any{"v": 1}})
+	if err := store.AddMany(ctx, db, []txoutbox.Message{
+		{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": 3}},
+		{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": 4}},
+	}); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+
+	var status string
+	if err := db.QueryRowContext(ctx, "SELECT status FROM txoutbox WHERE id = ?", first).Scan(&status); err != nil {
+		t.Fatalf("select status: %v", err)
+	}
+	if status != "superseded" {
+		t.Fatalf("status = %s, want superseded", status)
+	}
+
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 3 {
+		t.Fatalf("expected 3 envelopes, got %d", len(envs))
+	}
+	got := map[int64]int{}
+	for _, env := range envs {
+		got[env.ID] = env.Supersedes
+	}
+	if n, ok := got[other]; !ok || n != 0 {
+		t.Fatalf("other key supersedes = %d (claimed %v), want 0", n, ok)
+	}
+	if n, ok := got[plain]; !ok || n != 0 {
+		t.Fatalf("uncoalesced topic supersedes = %d (claimed %v), want 0", n, ok)
+	}
+	var latest txoutbox.Envelope
+	for _, env := range envs {
+		if env.Topic == "entity.state" && *env.Key == "user-1" {
+			latest = env
+		}
+	}
+	var payload map[string]int
+	if err := latest.Decode(&payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload["v"] != 4 || latest.Supersedes != 3 {
+		t.Fatalf("latest v=%d supersedes=%d, want v=4 supersedes=3", payload["v"], latest.Supersedes)
+	}
+
+	// A claimed message is delivered even when a newer one arrives.
+	add(txoutbox.Message{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": 5}})
+	if err := db.QueryRowContext(ctx, "SELECT status FROM txoutbox WHERE id = ?", latest.ID).Scan(&status); err != nil {
+		t.Fatalf("select status: %v", err)
+	}
+	if status != "sending" {
+		t.Fatalf("claimed status = %s, want sending", status)
+	}
+}
+
+func TestSQLiteStoreOrderedKeysSkipSuperseded(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db, stores.WithSQLiteCoalescedTopics("entity.state"), stores.WithSQLiteOrderedKeys(true))
+	for v := 1; v <= 2; v++ {
+		if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "entity.state", Key: "user-1", Body: map[string]any{"v": v}}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Claim error: %v", err)
+	}
+	if len(envs) != 1 || envs[0].Supersedes != 1 {
+		t.Fatalf("claimed %+v, want the newest message superseding 1", envs)
+	}
+}
+
+func TestSQLiteStoreBulkAcknowledgementsChunkBindParams(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db, stores.WithSQLiteAttemptsTable("txoutbox_attempts"))
+	// A retry binds nine values per row, so 4000 acks exceed SQLite's 32766 limit in a single statement.
+	const n = 4000
+	msgs := make([]txoutbox.Message, n)
+	for i := range msgs {
+		msgs[i] = txoutbox.Message{Topic: "bulk", Body: map[string]any{"n": i}}
+	}
+	if err := store.AddMany(ctx, db, msgs); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+	envs, err := store.Claim(ctx, "worker-a", n, time.Minute)
+	if err != nil || len(envs) != n {
+		t.Fatalf("Claim = %d envelopes, %v; want %d, nil", len(envs), err, n)
+	}
+	now := time.Now().UTC()
+	acks := make([]txoutbox.Ack, n)
+	for i, env := range envs {
+		acks[i] = txoutbox.Ack{Lease: env.Lease(), Attempt: txoutbox.Attempt{Number: 1, At: now, Err: errors.New("timeout")}, NextRetry: now.Add(time.Hour)}
+	}
+	lost, err := store.RetryMany(ctx, acks)
+	if err != nil || len(lost) != 0 {
+		t.Fatalf("RetryMany = %v, %v; want no lost leases", lost, err)
+	}
+
+	var retried, attempts int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox WHERE status = 'retry'").Scan(&retried); err != nil {
+		t.Fatalf("count retried: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox_attempts").Scan(&attempts); err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+	if retried != n || attempts != n {
+		t.Fatalf("retried = %d, attempts = %d; want %d each", retried, attempts, n)
+	}
+}
+
+func TestSQLiteStoreDedupKeyReturnsOtherErrors(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	// A conflict on any other unique index is not a duplicate and must not be skipped.
+	if _, err := db.ExecContext(ctx, `CREATE UNIQUE INDEX txoutbox_singleton_idx ON txoutbox (topic) WHERE topic = 'singleton'`); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	store := stores.NewSQLite(db)
+	if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "singleton", Body: 1, DedupKey: "req-1"}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	msg := txoutbox.Message{Topic: "singleton", Body: 2, DedupKey: "req-2"}
+	if _, err := store.Add(ctx, db, msg); err == nil || errors.Is(err, txoutbox.ErrDuplicate) {
+		t.Fatalf("Add error = %v, want the unique constraint error", err)
+	}
+	if err := store.AddMany(ctx, db, []txoutbox.Message{msg}); err == nil {
+		t.Fatal("expected AddMany to return the unique constraint error")
+	}
+}
+
+func TestSQLiteStorePurgeArchived(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	store := stores.NewSQLite(db,
+		stores.WithSQLiteAttemptsTable("txoutbox_attempts"),
+		stores.WithSQLiteArchiveTable("txoutbox_archive"),
+		stores.WithSQLiteNow(func() time.Time { return now }),
+	)
+	if _, err := stores.NewSQLite(db).PurgeArchived(ctx, now, 10); !errors.Is(err, txoutbox.ErrNoArchive) {
+		t.Fatalf("PurgeArchived without an archive table error = %v, want %v", err, txoutbox.ErrNoArchive)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := store.Add(ctx, db, txoutbox.Message{Topic: "purge", Body: map[string]any{"n": i}}); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	envs, err := store.Claim(ctx, "worker", 10, time.Minute)
+	if err != nil || len(envs) != 3 {
+		t.Fatalf("Claim = %d envelopes, %v; want 3, nil", len(envs), err)
+	}
+	old := now.Add(-48 * time.Hour)
+	for i, env := range envs {
+		at := old
+		if i == 2 {
+			at = now
+		}
+		if err := store.Send(ctx, env.Lease(), txoutbox.Attempt{Number: 1, At: at}); err != nil {
+			t.Fatalf("Send error: %v", err)
+		}
+	}
+
+	n, err := store.PurgeArchived(ctx, now.Add(-24*time.Hour), 10)
+	if err != nil || n != 2 {
+		t.Fatalf("PurgeArchived = %d, %v; want 2, nil", n, err)
+	}
+	archived, err := store.ListArchived(ctx, txoutbox.ArchiveFilter{}, txoutbox.Page{})
+	if err != nil {
+		t.Fatalf("ListArchived error: %v", err)
+	}
+	if len(archived) != 1 || archived[0].ID != envs[2].ID {
+		t.Fatalf("archived = %+v, want only message %d", archived, envs[2].ID)
+	}
+	var history int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox_attempts").Scan(&history); err != nil {
+		t.Fatalf("count attempts: %v", err)
+	}
+	if history != 1 {
+		t.Fatalf("remaining attempt rows = %d, want 1", history)
+	}
+}
+
+func TestSQLiteStoreReleaseChunksBindParams(t *testing.T) {
+	t.Parallel()
+	db := database.OpenSQLite(t)
+	ctx := context.Background()
+
+	store := stores.NewSQLite(db)
+	// Each lease binds three values, so 12000 leases exceed SQLite's 32766 limit in a single statement.
+	const n = 12000
+	msgs := make([]txoutbox.Message, n)
+	for i := range msgs {
+		msgs[i] = txoutbox.Message{Topic: "release", Body: map[string]any{"n": i}}
+	}
+	if err := store.AddMany(ctx, db, msgs); err != nil {
+		t.Fatalf("AddMany error: %v", err)
+	}
+	envs, err := store.Claim(ctx, "worker-a", n, time.Hour)
+	if err != nil || len(envs) != n {
+		t.Fatalf("Claim = %d envelopes, %v; want %d, nil", len(envs), err, n)
+	}
+	leases := make([]txoutbox.Lease, n)
+	for i, env := range envs {
+		leases[i] = env.Lease()
+	}
+	released, err := store.Release(ctx, leases)
+	if err != nil || released != n {
+		t.Fatalf("Release = %d, %v; want %d, nil", released, err, n)
+	}
+	var pending int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM txoutbox WHERE status = 'pending' AND claimed_by IS NULL").Scan(&pending); err != nil {
+		t.Fatalf("count pending: %v", err)
+	}
+	if pending != n {
+		t.Fatalf("pending rows = %d, want %d", pending, n)
+	}
+}
+
+// BenchmarkSQLiteStoreAcknowledgements times recording a batch of 100 deliveries against a real store, one
+// transaction per envelope versus one SendMany transaction.
+func BenchmarkSQLiteStoreAcknowledgements(b *testing.B) {
+	const batch = 100
+	ctx := context.Background()
+	run := func(b *testing.B, ack func(store *stores.SQLite, envs []txoutbox.Envelope) error) {
+		db := database.OpenSQLite(b)
+		store := stores.NewSQLite(db, stores.WithSQLiteAttemptsTable("txoutbox_attempts"))
+		msgs := make([]txoutbox.Message, batch)
+		for i := range msgs {
+			msgs[i] = txoutbox.Message{Topic: "bench", Body: map[string]any{"n": i}}
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			if err := store.AddMany(ctx, db, msgs); err != nil {
+				b.Fatalf("AddMany error: %v", err)
+			}
+			envs, err := store.Claim(ctx, "bench", batch, time.Minute)
+			if err != nil || len(envs) != batch {
+				b.Fatalf("Claim = %d envelopes, %v; want %d, nil", len(envs), err, batch)
+			}
+			b.StartTimer()
+			if err := ack(store, envs); err != nil {
+				b.Fatalf("acknowledge error: %v", err)
+			}
+		}
+	}
+	attempt := txoutbox.Attempt{Number: 1, At: time.Now().UTC()}
+
+	b.Run("per-envelope", func(b *testing.B) {
+		run(b, func(store *stores.SQLite, envs []txoutbox.Envelope) error {
+			for _, env := range envs {
+				if err := store.Send(ctx, env.Lease(), attempt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("bulk", func(b *testing.B) {
+		run(b, func(store *stores.SQLite, envs []txoutbox.Envelope) error {
+			acks := make([]txoutbox.Ack, len(envs))
+			for i, env := range envs {
+				acks[i] = txoutbox.Ack{Lease: env.Lease(), Attempt: attempt}
+			}
+			_, err := store.SendMany(ctx, acks)
+			return err
+		})
+	})
+}
@@ -11,7 +11,7 @@ import (
 )
 
 // OpenSQLite returns an in-memory SQLite DB with the txoutbox table ensured.
-func OpenSQLite(t *testing.T) *sql.DB {
+func OpenSQLite(t testing.TB) *sql.DB {
 	t.Helper()
 	dsn := fmt.Sprintf("file:txoutbox_%d?mode=memory&cache=shared&_foreign_keys=on", time.Now().UnixNano())
 	db, err := sql.Open("sqlite", dsn)
@@ -30,13 +30,45 @@ func OpenSQLite(t *testing.T) *sql.DB {
         topic TEXT NOT NULL,
         key TEXT,
         payload BLOB NOT NULL,
+        headers TEXT,
+        traceparent TEXT,
+        tracestate TEXT,
         status TEXT NOT NULL DEFAULT 'pending',
         retry_count INTEGER NOT NULL DEFAULT 0,
         next_retry_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
         claimed_by TEXT,
         claimed_at TIMESTAMP,
+        lease_token INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT,
+        last_attempt_at TIMESTAMP,
         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-        sent_at TIMESTAMP
+        sent_at TIMESTAMP,
+        dedup_key TEXT,
+        supersedes INTEGER NOT NULL DEFAULT 0
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS txoutbox_dedup_key_idx ON txoutbox (dedup_key);
+    CREATE TABLE IF NOT EXISTS txoutbox_attempts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        message_id INTEGER NOT NULL,
+        attempt INTEGER NOT NULL,
+        worker_id TEXT NOT NULL,
+        status TEXT NOT NULL,
+        error TEXT,
+        duration_ms INTEGER NOT NULL,
+        attempted_at TIMESTAMP NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS txoutbox_archive (
+        id INTEGER PRIMARY KEY,
+        topic TEXT NOT NULL,
+        key TEXT,
+        payload BLOB NOT NULL,
+        headers TEXT,
+        traceparent TEXT,
+        tracestate TEXT,
+        retry_count INTEGER NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        claimed_by TEXT,
+        sent_at TIMESTAMP NOT NULL
     );`
 	if _, err := db.ExecContext(ctx, schema); err != nil {
 		t.Fatalf("create schema: %v", err)
@@ -44,5 +76,11 @@ func OpenSQLite(t *testing.T) *sql.DB {
 	if _, err := db.ExecContext(ctx, `DELETE FROM txoutbox`); err != nil {
 		t.Fatalf("truncate txoutbox: %v", err)
 	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM txoutbox_attempts`); err != nil {
+		t.Fatalf("truncate txoutbox_attempts: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM txoutbox_archive`); err != nil {
+		t.Fatalf("truncate txoutbox_archive: %v", err)
+	}
 	return db
 }
@@ -0,0 +1,32 @@
+package txoutbox
+
+import "context"
+
+// TraceContext holds the W3C trace context captured when a message is enqueued.
+type TraceContext struct {
+	// TraceParent is the W3C traceparent value (e.g. "00-<trace-id>-<span-id>-01").
+	TraceParent string
+	// TraceState is the optional W3C tracestate value.
+	TraceState string
+}
+
+// IsZero reports whether no trace context was captured.
+func (tc TraceContext) IsZero() bool {
+	return tc.TraceParent == ""
+}
+
+// Propagator moves trace context between a context.Context and an outbox row.
+// Stores use Inject inside Add; the Relay uses Extract before calling the Sender and Hooks.
+type Propagator interface {
+	// Inject returns the trace context carried by ctx, or the zero value when there is none.
+	Inject(ctx context.Context) TraceContext
+	// Extract returns a copy of ctx carrying tc so work done during delivery joins the original trace.
+	Extract(ctx context.Context, tc TraceContext) context.Context
+}
+
+// noopPropagator neither captures nor restores trace context.
+type noopPropagator struct{}
+
+func (noopPropagator) Inject(context.Context) TraceContext { return TraceContext{} }
+
+func (noopPropagator) Extract(ctx context.Context, _ TraceContext) context.Context { return ctx }